@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pavlegich/gophermart/internal/infra/accrual"
+	"github.com/pavlegich/gophermart/internal/infra/logger"
+	"go.uber.org/zap"
+)
+
+type responseHealth struct {
+	Status   string          `json:"status"`
+	Database string          `json:"database"`
+	Accrual  responseBreaker `json:"accrual"`
+}
+
+type responseBreaker struct {
+	State    string `json:"state"`
+	Failures int    `json:"failures"`
+	OpenedAt string `json:"opened_at,omitempty"`
+}
+
+// HandleHealth передаёт состояние базы данных и автоматического выключателя системы начисления баллов;
+// недоступность базы данных делает сервис неработоспособным, открытый выключатель только ухудшает работу
+func (c *Controller) HandleHealth(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	stats := c.breaker.Stats()
+	resp := responseHealth{
+		Status:   "ok",
+		Database: "ok",
+		Accrual: responseBreaker{
+			State:    stats.State,
+			Failures: stats.Failures,
+		},
+	}
+	if stats.State != accrual.BreakerClosed {
+		resp.Status = "degraded"
+		resp.Accrual.OpenedAt = stats.OpenedAt.Format(time.RFC3339)
+	}
+
+	status := http.StatusOK
+	if err := c.db.PingContext(ctx); err != nil {
+		logger.Log.Error("HandleHealth: connection to database in died",
+			zap.Error(err))
+		resp.Status = "unavailable"
+		resp.Database = "unavailable"
+		status = http.StatusServiceUnavailable
+	}
+
+	respJSON, err := json.Marshal(resp)
+	if err != nil {
+		logger.Log.Error("HandleHealth: response marshal failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write([]byte(respJSON))
+}
+
+// HandleMetrics передаёт метрики автоматического выключателя в текстовом формате Prometheus
+func (c *Controller) HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	stats := c.breaker.Stats()
+
+	var b strings.Builder
+	b.WriteString("# HELP accrual_circuit_breaker_state Current accrual circuit breaker state.\n")
+	b.WriteString("# TYPE accrual_circuit_breaker_state gauge\n")
+	for _, state := range []string{accrual.BreakerClosed, accrual.BreakerOpen, accrual.BreakerHalfOpen} {
+		value := 0
+		if state == stats.State {
+			value = 1
+		}
+		fmt.Fprintf(&b, "accrual_circuit_breaker_state{state=%q} %d\n", state, value)
+	}
+	b.WriteString("# HELP accrual_circuit_breaker_failures Consecutive failed requests to accrual system.\n")
+	b.WriteString("# TYPE accrual_circuit_breaker_failures gauge\n")
+	fmt.Fprintf(&b, "accrual_circuit_breaker_failures %d\n", stats.Failures)
+	b.WriteString("# HELP accrual_circuit_breaker_opens_total Times the accrual circuit breaker opened.\n")
+	b.WriteString("# TYPE accrual_circuit_breaker_opens_total counter\n")
+	fmt.Fprintf(&b, "accrual_circuit_breaker_opens_total %d\n", stats.Opens)
+	b.WriteString("# HELP accrual_circuit_breaker_rejected_total Requests rejected by the open circuit breaker.\n")
+	b.WriteString("# TYPE accrual_circuit_breaker_rejected_total counter\n")
+	fmt.Fprintf(&b, "accrual_circuit_breaker_rejected_total %d\n", stats.Rejected)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(b.String()))
+}
@@ -6,21 +6,28 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/pavlegich/gophermart/internal/controllers/middlewares"
+	admins "github.com/pavlegich/gophermart/internal/domains/admin/controllers/http"
 	balances "github.com/pavlegich/gophermart/internal/domains/balance/controllers/http"
 	orders "github.com/pavlegich/gophermart/internal/domains/order/controllers/http"
+	"github.com/pavlegich/gophermart/internal/domains/session"
+	sessions "github.com/pavlegich/gophermart/internal/domains/session/controllers/http"
+	sessionRepo "github.com/pavlegich/gophermart/internal/domains/session/repository"
 	users "github.com/pavlegich/gophermart/internal/domains/user/controllers/http"
+	"github.com/pavlegich/gophermart/internal/infra/accrual"
 	"github.com/pavlegich/gophermart/internal/infra/config"
 )
 
 type Controller struct {
-	db  *sql.DB
-	cfg *config.Config
+	db      *sql.DB
+	cfg     *config.Config
+	breaker *accrual.Breaker
 }
 
 func NewController(db *sql.DB, cfg *config.Config) *Controller {
 	return &Controller{
-		db:  db,
-		cfg: cfg,
+		db:      db,
+		cfg:     cfg,
+		breaker: accrual.NewBreaker(cfg.BreakerLimit, cfg.BreakerTimeout),
 	}
 }
 
@@ -29,14 +36,21 @@ func (c *Controller) BuildRoute(ctx context.Context) *chi.Mux {
 	r := chi.NewRouter()
 
 	r.Use(middlewares.WithLogging)
-	r.Use(middlewares.WithAuth(c.cfg.JWT))
 	r.Use(middlewares.WithCompress)
 
-	r.Get("/", c.HandleMain)
+	// Публичные маршруты и маршруты, требующие аутентификации
+	public := r.With()
+	protected := r.With(middlewares.WithAuth(c.cfg.JWT, session.NewSessionService(sessionRepo.NewSessionRepo(c.db))))
 
-	users.Activate(r, c.cfg, c.db)
-	orders.Activate(ctx, r, c.cfg, c.db)
-	balances.Activate(r, c.cfg, c.db)
+	public.Get("/", c.HandleMain)
+	public.Get("/api/health", c.HandleHealth)
+	public.Get("/metrics", c.HandleMetrics)
+
+	users.Activate(public, protected, c.cfg, c.db)
+	sessions.Activate(public, protected, c.cfg, c.db)
+	orders.Activate(ctx, public, protected, c.cfg, c.db, c.breaker)
+	balances.Activate(ctx, public, protected, c.cfg, c.db)
+	admins.Activate(public, protected, c.cfg, c.db)
 
 	return r
 }
@@ -2,22 +2,24 @@ package middlewares
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 
+	"github.com/pavlegich/gophermart/internal/domains/session"
+	errs "github.com/pavlegich/gophermart/internal/errors"
 	"github.com/pavlegich/gophermart/internal/infra/hash"
+	"github.com/pavlegich/gophermart/internal/infra/logger"
 	"github.com/pavlegich/gophermart/internal/utils"
+	"go.uber.org/zap"
 )
 
-// WithAuth обрабатывает токен авторизации
-func WithAuth(j *hash.JWT) func(http.Handler) http.Handler {
+// WithAuth обрабатывает токен авторизации, применяется только к защищённым маршрутам
+func WithAuth(j *hash.JWT, s session.Service) func(http.Handler) http.Handler {
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if r.RequestURI == "/api/user/register" || r.RequestURI == "/api/user/login" ||
-				r.RequestURI == "/" {
-				h.ServeHTTP(w, r)
-				return
-			}
-			cookie, err := r.Cookie("auth")
+			tokenString, err := tokenFromRequest(r)
 			if err != nil {
 				if err == http.ErrNoCookie {
 					w.WriteHeader(http.StatusUnauthorized)
@@ -26,13 +28,52 @@ func WithAuth(j *hash.JWT) func(http.Handler) http.Handler {
 				w.WriteHeader(http.StatusBadRequest)
 				return
 			}
-			id, err := j.Validate(cookie.Value)
+			claims, err := j.Validate(tokenString)
 			if err != nil {
 				w.WriteHeader(http.StatusUnauthorized)
 				return
 			}
-			ctx := context.WithValue(r.Context(), utils.ContextIDKey, id)
+
+			// Проверка, что сессия токена не отозвана
+			sessionID := claims.SessionID
+			if err := s.Check(r.Context(), sessionID, claims.ID); err != nil {
+				if errors.Is(err, errs.ErrSessionNotFound) || errors.Is(err, errs.ErrSessionRevoked) ||
+					errors.Is(err, errs.ErrSessionExpired) {
+					w.WriteHeader(http.StatusUnauthorized)
+				} else {
+					logger.Log.Error("WithAuth: check session failed",
+						zap.Error(err))
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+				return
+			}
+
+			principal := &utils.Principal{
+				UserID:    claims.ID,
+				Role:      claims.Role,
+				SessionID: sessionID,
+			}
+			ctx := context.WithValue(r.Context(), utils.ContextPrincipalKey, principal)
 			h.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
+
+// tokenFromRequest возвращает токен доступа из запроса: заголовок Authorization
+// имеет приоритет над cookie, при его наличии cookie не проверяется
+func tokenFromRequest(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	if header != "" {
+		scheme, token, ok := strings.Cut(header, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+			return "", fmt.Errorf("tokenFromRequest: malformed authorization header")
+		}
+		return strings.TrimSpace(token), nil
+	}
+
+	cookie, err := r.Cookie("auth")
+	if err != nil {
+		return "", err
+	}
+	return cookie.Value, nil
+}
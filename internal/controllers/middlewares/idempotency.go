@@ -0,0 +1,150 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/pavlegich/gophermart/internal/domains/idempotency"
+	errs "github.com/pavlegich/gophermart/internal/errors"
+	"github.com/pavlegich/gophermart/internal/infra/hash"
+	"github.com/pavlegich/gophermart/internal/infra/logger"
+	"github.com/pavlegich/gophermart/internal/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxIdempotencyKeyLen максимальная длина ключа идемпотентности
+	maxIdempotencyKeyLen = 255
+	// maxIdempotentBodySize максимальный размер тела запроса с ключом идемпотентности
+	maxIdempotentBodySize = 1 << 20
+	// idempotencySaveTimeout время на сохранение ответа или освобождение ключа после завершения обработчика
+	idempotencySaveTimeout = 5 * time.Second
+)
+
+// WithIdempotency сохраняет ответ на запрос с заголовком Idempotency-Key и повторяет его
+// при повторной отправке того же запроса; применяется после WithAuth
+func WithIdempotency(s idempotency.Service) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("Idempotency-Key")
+			if key == "" {
+				h.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLen {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			ctx := r.Context()
+			userID, err := utils.GetUserIDFromContext(ctx)
+			if err != nil {
+				logger.Log.Error("WithIdempotency: get user id from context failed",
+					zap.Error(err))
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			// Отпечаток запроса строится по методу, пути и телу
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodySize))
+			if err != nil {
+				var maxErr *http.MaxBytesError
+				if errors.As(err, &maxErr) {
+					w.WriteHeader(http.StatusRequestEntityTooLarge)
+				} else {
+					w.WriteHeader(http.StatusBadRequest)
+				}
+				return
+			}
+			r.Body.Close()
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			rec := idempotency.Record{
+				UserID:      userID,
+				Key:         key,
+				Fingerprint: hash.Sum(r.Method + " " + r.URL.Path + "\n" + string(body)),
+			}
+
+			stored, err := s.Begin(ctx, &rec)
+			if err != nil {
+				if errors.Is(err, errs.ErrIdempotencyKeyMismatch) {
+					w.WriteHeader(http.StatusUnprocessableEntity)
+				} else if errors.Is(err, errs.ErrIdempotencyKeyInProgress) {
+					w.WriteHeader(http.StatusConflict)
+				} else {
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+				logger.Log.Error("WithIdempotency: begin request failed",
+					zap.String("key", key),
+					zap.Error(err))
+				return
+			}
+
+			// Повтор сохранённого ответа
+			if stored != nil {
+				if stored.ContentType != "" {
+					w.Header().Set("Content-Type", stored.ContentType)
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(stored.Status)
+				w.Write(stored.Body)
+				return
+			}
+
+			responseData := &logger.ResponseData{
+				Status: 0,
+				Size:   0,
+				Body:   bytes.NewBufferString(""),
+			}
+			lw := logger.LoggingResponseWriter{
+				ResponseWriter: w,
+				ResponseData:   responseData,
+			}
+
+			// Ключ освобождается и при панике обработчика, паника передаётся дальше в Recovery;
+			// освобождение и сохранение ответа не зависят от отмены запроса клиентом, иначе повтор
+			// запроса после обрыва соединения выполнил бы уже проведённую операцию ещё раз
+			release := func() {
+				ctx, cancel := context.WithTimeout(context.Background(), idempotencySaveTimeout)
+				defer cancel()
+				if err := s.Release(ctx, &rec); err != nil {
+					logger.Log.Error("WithIdempotency: release key failed",
+						zap.String("key", key),
+						zap.Error(err))
+				}
+			}
+			defer func() {
+				if p := recover(); p != nil {
+					release()
+					panic(p)
+				}
+			}()
+
+			h.ServeHTTP(&lw, r)
+
+			// Ответ с ошибкой сервера не сохраняется, чтобы запрос можно было повторить
+			if responseData.Status == 0 {
+				responseData.Status = http.StatusOK
+			}
+			if responseData.Status >= http.StatusInternalServerError {
+				release()
+				return
+			}
+
+			rec.Status = responseData.Status
+			rec.ContentType = lw.Header().Get("Content-Type")
+			rec.Body = responseData.Body.Bytes()
+			saveCtx, cancel := context.WithTimeout(context.Background(), idempotencySaveTimeout)
+			defer cancel()
+			if err := s.Complete(saveCtx, &rec); err != nil {
+				logger.Log.Error("WithIdempotency: save response failed",
+					zap.String("key", key),
+					zap.Error(err))
+			}
+		})
+	}
+}
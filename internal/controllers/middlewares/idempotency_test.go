@@ -0,0 +1,74 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pavlegich/gophermart/internal/domains/idempotency"
+	"github.com/pavlegich/gophermart/internal/utils"
+)
+
+// fakeIdempotency запоминает сохранённый ответ и состояние контекста при сохранении
+type fakeIdempotency struct {
+	completed *idempotency.Record
+	ctxErr    error
+}
+
+func (f *fakeIdempotency) Begin(ctx context.Context, rec *idempotency.Record) (*idempotency.Record, error) {
+	return nil, nil
+}
+
+func (f *fakeIdempotency) Complete(ctx context.Context, rec *idempotency.Record) error {
+	f.completed = rec
+	f.ctxErr = ctx.Err()
+	return nil
+}
+
+func (f *fakeIdempotency) Release(ctx context.Context, rec *idempotency.Record) error {
+	return nil
+}
+
+func TestWithIdempotencySavesAfterClientDisconnect(t *testing.T) {
+	s := &fakeIdempotency{}
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(),
+		utils.ContextPrincipalKey, &utils.Principal{UserID: 7}))
+	defer cancel()
+
+	// Клиент отключается после того, как обработчик провёл операцию
+	h := WithIdempotency(s)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		cancel()
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/user/balance/transfer", strings.NewReader(`{}`)).WithContext(ctx)
+	req.Header.Set("Idempotency-Key", "key")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if s.completed == nil || s.completed.Status != http.StatusOK {
+		t.Fatalf("expected response to be saved, got %+v", s.completed)
+	}
+	if s.ctxErr != nil {
+		t.Fatalf("expected save context to outlive the request, got %v", s.ctxErr)
+	}
+}
+
+func TestWithIdempotencyLimitsBody(t *testing.T) {
+	s := &fakeIdempotency{}
+	ctx := context.WithValue(context.Background(), utils.ContextPrincipalKey, &utils.Principal{UserID: 7})
+	h := WithIdempotency(s)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatalf("handler must not be called for oversized body")
+	}))
+
+	body := strings.NewReader(strings.Repeat("a", maxIdempotentBodySize+1))
+	req := httptest.NewRequest(http.MethodPost, "/api/user/orders", body).WithContext(ctx)
+	req.Header.Set("Idempotency-Key", "key")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected %d, got %d", http.StatusRequestEntityTooLarge, rec.Code)
+	}
+}
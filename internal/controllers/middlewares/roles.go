@@ -0,0 +1,30 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/pavlegich/gophermart/internal/infra/logger"
+	"github.com/pavlegich/gophermart/internal/utils"
+	"go.uber.org/zap"
+)
+
+// RequireRoles пропускает запрос, только если роль пользователя входит в список допустимых;
+// применяется после WithAuth
+func RequireRoles(roles ...string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, err := utils.GetPrincipalFromContext(r.Context())
+			if err != nil {
+				logger.Log.Error("RequireRoles: get principal from context failed",
+					zap.Error(err))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if !principal.HasRole(roles...) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,612 @@
+package http
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pavlegich/gophermart/internal/controllers/middlewares"
+	"github.com/pavlegich/gophermart/internal/domains/admin"
+	"github.com/pavlegich/gophermart/internal/domains/balance"
+	balanceRepo "github.com/pavlegich/gophermart/internal/domains/balance/repository"
+	"github.com/pavlegich/gophermart/internal/domains/ledger"
+	ledgerRepo "github.com/pavlegich/gophermart/internal/domains/ledger/repository"
+	orderRepo "github.com/pavlegich/gophermart/internal/domains/order/repository"
+	sessionRepo "github.com/pavlegich/gophermart/internal/domains/session/repository"
+	"github.com/pavlegich/gophermart/internal/domains/user"
+	userRepo "github.com/pavlegich/gophermart/internal/domains/user/repository"
+	errs "github.com/pavlegich/gophermart/internal/errors"
+	"github.com/pavlegich/gophermart/internal/infra/config"
+	"github.com/pavlegich/gophermart/internal/infra/logger"
+	"github.com/pavlegich/gophermart/internal/utils"
+	"go.uber.org/zap"
+)
+
+type (
+	AdminHandler struct {
+		Config  *config.Config
+		Service admin.Service
+	}
+
+	responseUser struct {
+		ID        int     `json:"id"`
+		Login     string  `json:"login"`
+		Role      string  `json:"role"`
+		Blocked   bool    `json:"blocked"`
+		BlockedAt *string `json:"blocked_at,omitempty"`
+	}
+
+	responseOrder struct {
+		Number     string      `json:"number"`
+		Status     string      `json:"status"`
+		Accrual    utils.Money `json:"accrual,omitempty"`
+		UploadedAt string      `json:"uploaded_at"`
+	}
+
+	responseStaleOrder struct {
+		Number     string `json:"number"`
+		UserID     int    `json:"user_id"`
+		Status     string `json:"status"`
+		Attempts   int    `json:"attempts"`
+		UploadedAt string `json:"uploaded_at"`
+		StaleAt    string `json:"stale_at"`
+	}
+
+	responseOperation struct {
+		ID             int         `json:"id"`
+		Action         string      `json:"action"`
+		Amount         utils.Money `json:"amount"`
+		Order          string      `json:"order,omitempty"`
+		OperatorID     int         `json:"operator_id,omitempty"`
+		Reason         string      `json:"reason,omitempty"`
+		ReversalOf     int         `json:"reversal_of,omitempty"`
+		CounterpartyID int         `json:"counterparty_id,omitempty"`
+		ProcessedAt    string      `json:"processed_at"`
+	}
+
+	requestAdjustment struct {
+		Amount utils.Money `json:"amount"`
+		Reason string      `json:"reason"`
+	}
+
+	requestReversal struct {
+		Amount utils.Money `json:"amount"`
+		Reason string      `json:"reason"`
+	}
+
+	responseReversal struct {
+		ID           int         `json:"id"`
+		WithdrawalID int         `json:"withdrawal_id"`
+		UserID       int         `json:"user_id"`
+		Order        string      `json:"order"`
+		Amount       utils.Money `json:"amount"`
+		Reason       string      `json:"reason,omitempty"`
+		OperatorID   int         `json:"operator_id"`
+		ProcessedAt  string      `json:"processed_at"`
+	}
+
+	responseAdjustment struct {
+		ID          int         `json:"id"`
+		Amount      utils.Money `json:"amount"`
+		Reason      string      `json:"reason"`
+		OperatorID  int         `json:"operator_id"`
+		ProcessedAt string      `json:"processed_at"`
+	}
+)
+
+// Activate активирует обработчик запросов администратора
+func Activate(public chi.Router, protected chi.Router, cfg *config.Config, db *sql.DB) {
+	s := admin.NewAdminService(userRepo.NewUserRepo(db), orderRepo.NewOrderRepo(db),
+		balanceRepo.NewBalanceRepo(db), sessionRepo.NewSessionRepo(db),
+		ledger.NewLedgerService(ledgerRepo.NewLedgerRepo(db, cfg.PointsExpiry)))
+	newHandler(public, protected, cfg, s)
+}
+
+// newHandler инициализирует обработчик запросов администратора
+func newHandler(public chi.Router, protected chi.Router, cfg *config.Config, s admin.Service) {
+	h := AdminHandler{
+		Config:  cfg,
+		Service: s,
+	}
+	r := protected.With(middlewares.RequireRoles(user.RoleAdmin))
+	r.Get("/api/admin/users", h.HandleUserGet)
+	r.Get("/api/admin/users/{id}/orders", h.HandleUserOrdersGet)
+	r.Get("/api/admin/users/{id}/operations", h.HandleUserOperationsGet)
+	r.Post("/api/admin/users/{id}/block", h.HandleUserBlock)
+	r.Post("/api/admin/users/{id}/unblock", h.HandleUserUnblock)
+	r.Post("/api/admin/orders/{number}/recheck", h.HandleOrderRecheck)
+	r.Get("/api/admin/orders/stale", h.HandleStaleOrdersGet)
+	r.Post("/api/admin/orders/{number}/requeue", h.HandleOrderRequeue)
+	r.Get("/api/admin/accounts/verify", h.HandleAccountsVerify)
+	r.Get("/api/admin/ledger/trial-balance", h.HandleTrialBalance)
+
+	// Корректировки баланса доступны также сотрудникам поддержки
+	protected.With(middlewares.RequireRoles(user.RoleAdmin, user.RoleSupport)).
+		Post("/api/admin/users/{id}/adjustments", h.HandleBalanceAdjust)
+	protected.With(middlewares.RequireRoles(user.RoleAdmin, user.RoleSupport)).
+		Post("/api/admin/withdrawals/{id}/reverse", h.HandleWithdrawalReverse)
+}
+
+// HandleUserGet ищет пользователя по логину
+func (h *AdminHandler) HandleUserGet(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	login := r.URL.Query().Get("login")
+	if login == "" {
+		logger.Log.Error("HandleUserGet: login is empty")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	storedUser, err := h.Service.FindUser(ctx, login)
+	if err != nil {
+		if errors.Is(err, errs.ErrUserNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		logger.Log.Error("HandleUserGet: find user failed",
+			zap.String("login", login),
+			zap.Error(err))
+		return
+	}
+
+	resp := responseUser{
+		ID:      storedUser.ID,
+		Login:   storedUser.Login,
+		Role:    storedUser.Role,
+		Blocked: storedUser.BlockedAt != nil,
+	}
+	if storedUser.BlockedAt != nil {
+		blockedAt := storedUser.BlockedAt.Format(time.RFC3339)
+		resp.BlockedAt = &blockedAt
+	}
+
+	writeJSON(w, "HandleUserGet", resp)
+}
+
+// HandleUserOrdersGet передаёт список заказов пользователя
+func (h *AdminHandler) HandleUserOrdersGet(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		logger.Log.Error("HandleUserOrdersGet: convert user id into integer failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	ordersList, err := h.Service.ListOrders(ctx, userID)
+	if err != nil {
+		logger.Log.Error("HandleUserOrdersGet: get orders list failed",
+			zap.Int("user_id", userID),
+			zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if len(ordersList) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	resp := make([]responseOrder, 0)
+	for _, o := range ordersList {
+		resp = append(resp, responseOrder{
+			Number:     o.Number,
+			Status:     o.Status,
+			Accrual:    o.Accrual,
+			UploadedAt: o.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	writeJSON(w, "HandleUserOrdersGet", resp)
+}
+
+// HandleUserOperationsGet передаёт список операций по балансу пользователя
+func (h *AdminHandler) HandleUserOperationsGet(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		logger.Log.Error("HandleUserOperationsGet: convert user id into integer failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	operations, err := h.Service.ListOperations(ctx, userID)
+	if err != nil {
+		logger.Log.Error("HandleUserOperationsGet: get balance operations failed",
+			zap.Int("user_id", userID),
+			zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if len(operations) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	resp := make([]responseOperation, 0)
+	for _, b := range operations {
+		resp = append(resp, responseOperation{
+			ID:             b.ID,
+			Action:         b.Action,
+			Amount:         b.Amount,
+			Order:          b.Order,
+			OperatorID:     b.OperatorID,
+			Reason:         b.Reason,
+			ReversalOf:     b.ReversalOf,
+			CounterpartyID: b.CounterpartyID,
+			ProcessedAt:    b.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	writeJSON(w, "HandleUserOperationsGet", resp)
+}
+
+// HandleUserBlock блокирует учётную запись пользователя
+func (h *AdminHandler) HandleUserBlock(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		logger.Log.Error("HandleUserBlock: convert user id into integer failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Администратор не может заблокировать сам себя
+	operatorID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		logger.Log.Error("HandleUserBlock: get user id from context failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if operatorID == userID {
+		logger.Log.Error("HandleUserBlock: operator tried to block own account",
+			zap.Int("user_id", userID))
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	if err := h.Service.BlockUser(ctx, userID); err != nil {
+		if errors.Is(err, errs.ErrUserNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		logger.Log.Error("HandleUserBlock: block user failed",
+			zap.Int("user_id", userID),
+			zap.Error(err))
+		return
+	}
+
+	logger.Log.Info("user blocked",
+		zap.Int("user_id", userID),
+		zap.Int("operator_id", operatorID))
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleUserUnblock разблокирует учётную запись пользователя
+func (h *AdminHandler) HandleUserUnblock(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		logger.Log.Error("HandleUserUnblock: convert user id into integer failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Service.UnblockUser(ctx, userID); err != nil {
+		if errors.Is(err, errs.ErrUserNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		logger.Log.Error("HandleUserUnblock: unblock user failed",
+			zap.Int("user_id", userID),
+			zap.Error(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleOrderRecheck отправляет заказ на повторную проверку в системе начисления баллов
+func (h *AdminHandler) HandleOrderRecheck(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	number := chi.URLParam(r, "number")
+	if err := h.Service.RecheckOrder(ctx, number); err != nil {
+		if errors.Is(err, errs.ErrOrderNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+		} else if errors.Is(err, errs.ErrOrderAlreadyProcessed) {
+			w.WriteHeader(http.StatusConflict)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		logger.Log.Error("HandleOrderRecheck: recheck order failed",
+			zap.String("order_id", number),
+			zap.Error(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// HandleStaleOrdersGet передаёт список заказов, опрос которых в системе начисления баллов остановлен
+func (h *AdminHandler) HandleStaleOrdersGet(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	jobs, err := h.Service.ListStaleOrders(ctx)
+	if err != nil {
+		logger.Log.Error("HandleStaleOrdersGet: get stale orders failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if len(jobs) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	resp := make([]responseStaleOrder, 0, len(jobs))
+	for _, j := range jobs {
+		resp = append(resp, responseStaleOrder{
+			Number:     j.Order.Number,
+			UserID:     j.Order.UserID,
+			Status:     j.Order.Status,
+			Attempts:   j.Attempts,
+			UploadedAt: j.Order.CreatedAt.Format(time.RFC3339),
+			StaleAt:    j.StaleAt.Format(time.RFC3339),
+		})
+	}
+
+	writeJSON(w, "HandleStaleOrdersGet", resp)
+}
+
+// HandleOrderRequeue возвращает остановленный заказ в очередь опроса системы начисления баллов
+func (h *AdminHandler) HandleOrderRequeue(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	number := chi.URLParam(r, "number")
+	if err := h.Service.RequeueOrder(ctx, number); err != nil {
+		if errors.Is(err, errs.ErrStaleJobNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		logger.Log.Error("HandleOrderRequeue: requeue order failed",
+			zap.String("order_id", number),
+			zap.Error(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// HandleBalanceAdjust проводит ручную корректировку баланса пользователя с указанием причины
+func (h *AdminHandler) HandleBalanceAdjust(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req requestAdjustment
+	var buf bytes.Buffer
+
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		logger.Log.Error("HandleBalanceAdjust: convert user id into integer failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	operatorID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		logger.Log.Error("HandleBalanceAdjust: get user id from context failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := buf.ReadFrom(r.Body); err != nil {
+		logger.Log.Error("HandleBalanceAdjust: read request body failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := json.Unmarshal(buf.Bytes(), &req); err != nil {
+		logger.Log.Error("HandleBalanceAdjust: request unmarshal failed",
+			zap.String("body", buf.String()),
+			zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	b := balance.Balance{
+		Amount:     req.Amount,
+		UserID:     userID,
+		OperatorID: operatorID,
+		Reason:     req.Reason,
+	}
+
+	if err := h.Service.AdjustBalance(ctx, &b); err != nil {
+		if errors.Is(err, errs.ErrUserNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+		} else if errors.Is(err, errs.ErrIncorrectAdjustment) {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		} else if errors.Is(err, errs.ErrInsufficientFunds) {
+			w.WriteHeader(http.StatusPaymentRequired)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		logger.Log.Error("HandleBalanceAdjust: adjust balance failed",
+			zap.Int("user_id", userID),
+			zap.Int("operator_id", operatorID),
+			zap.Error(err))
+		return
+	}
+
+	logger.Log.Info("balance adjusted",
+		zap.Int("user_id", userID),
+		zap.Int("operator_id", operatorID),
+		zap.Stringer("amount", b.Amount),
+		zap.String("reason", b.Reason))
+
+	writeJSON(w, "HandleBalanceAdjust", responseAdjustment{
+		ID:          b.ID,
+		Amount:      b.Amount,
+		Reason:      b.Reason,
+		OperatorID:  b.OperatorID,
+		ProcessedAt: b.CreatedAt.Format(time.RFC3339),
+	})
+}
+
+// HandleAccountsVerify сверяет счета пользователей с историей операций и передаёт расхождения
+func (h *AdminHandler) HandleAccountsVerify(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	mismatches, err := h.Service.VerifyAccounts(ctx)
+	if err != nil {
+		logger.Log.Error("HandleAccountsVerify: verify accounts failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if len(mismatches) > 0 {
+		logger.Log.Warn("accounts do not match balance history",
+			zap.Int("mismatches", len(mismatches)))
+	}
+
+	writeJSON(w, "HandleAccountsVerify", mismatches)
+}
+
+// HandleTrialBalance проверяет сходимость книги баллов
+func (h *AdminHandler) HandleTrialBalance(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	tb, err := h.Service.TrialBalance(ctx)
+	if err != nil {
+		logger.Log.Error("HandleTrialBalance: get trial balance failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !tb.Balanced {
+		logger.Log.Warn("ledger is not balanced",
+			zap.Stringer("total", tb.Total),
+			zap.Ints("unbalanced_postings", tb.UnbalancedPostings),
+			zap.Strings("mismatched_accounts", tb.MismatchedAccounts))
+	}
+
+	writeJSON(w, "HandleTrialBalance", tb)
+}
+
+// HandleWithdrawalReverse возвращает пользователю баллы по списанию полностью или частично
+func (h *AdminHandler) HandleWithdrawalReverse(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req requestReversal
+	var buf bytes.Buffer
+
+	withdrawalID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		logger.Log.Error("HandleWithdrawalReverse: convert withdrawal id into integer failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	operatorID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		logger.Log.Error("HandleWithdrawalReverse: get user id from context failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := buf.ReadFrom(r.Body); err != nil {
+		logger.Log.Error("HandleWithdrawalReverse: read request body failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+	// Пустое тело означает возврат всего невозвращённого остатка
+	if buf.Len() > 0 {
+		if err := json.Unmarshal(buf.Bytes(), &req); err != nil {
+			logger.Log.Error("HandleWithdrawalReverse: request unmarshal failed",
+				zap.String("body", buf.String()),
+				zap.Error(err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	b := balance.Balance{
+		Amount:     req.Amount,
+		OperatorID: operatorID,
+		Reason:     req.Reason,
+		ReversalOf: withdrawalID,
+	}
+
+	if err := h.Service.ReverseWithdrawal(ctx, &b); err != nil {
+		if errors.Is(err, errs.ErrWithdrawalNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+		} else if errors.Is(err, errs.ErrWithdrawalReversed) {
+			w.WriteHeader(http.StatusConflict)
+		} else if errors.Is(err, errs.ErrIncorrectAmount) {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		logger.Log.Error("HandleWithdrawalReverse: reverse withdrawal failed",
+			zap.Int("withdrawal_id", withdrawalID),
+			zap.Int("operator_id", operatorID),
+			zap.Error(err))
+		return
+	}
+
+	logger.Log.Info("withdrawal reversed",
+		zap.Int("withdrawal_id", withdrawalID),
+		zap.Int("user_id", b.UserID),
+		zap.Int("operator_id", operatorID),
+		zap.Stringer("amount", b.Amount))
+
+	writeJSON(w, "HandleWithdrawalReverse", responseReversal{
+		ID:           b.ID,
+		WithdrawalID: b.ReversalOf,
+		UserID:       b.UserID,
+		Order:        b.Order,
+		Amount:       b.Amount,
+		Reason:       b.Reason,
+		OperatorID:   b.OperatorID,
+		ProcessedAt:  b.CreatedAt.Format(time.RFC3339),
+	})
+}
+
+// writeJSON передаёт ответ в формате JSON
+func writeJSON(w http.ResponseWriter, handler string, resp any) {
+	respJSON, err := json.Marshal(resp)
+	if err != nil {
+		logger.Log.Error(handler+": response marshal failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(respJSON))
+}
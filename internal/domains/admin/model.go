@@ -0,0 +1,25 @@
+package admin
+
+import (
+	"context"
+
+	"github.com/pavlegich/gophermart/internal/domains/balance"
+	"github.com/pavlegich/gophermart/internal/domains/ledger"
+	"github.com/pavlegich/gophermart/internal/domains/order"
+	"github.com/pavlegich/gophermart/internal/domains/user"
+)
+
+type Service interface {
+	FindUser(ctx context.Context, login string) (*user.User, error)
+	ListOrders(ctx context.Context, userID int) ([]*order.Order, error)
+	ListOperations(ctx context.Context, userID int) ([]*balance.Balance, error)
+	RecheckOrder(ctx context.Context, number string) error
+	ListStaleOrders(ctx context.Context) ([]*order.Job, error)
+	RequeueOrder(ctx context.Context, number string) error
+	BlockUser(ctx context.Context, userID int) error
+	UnblockUser(ctx context.Context, userID int) error
+	AdjustBalance(ctx context.Context, adjustment *balance.Balance) error
+	ReverseWithdrawal(ctx context.Context, reversal *balance.Balance) error
+	VerifyAccounts(ctx context.Context) ([]*balance.AccountMismatch, error)
+	TrialBalance(ctx context.Context) (*ledger.TrialBalance, error)
+}
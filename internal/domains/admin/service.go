@@ -0,0 +1,141 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pavlegich/gophermart/internal/domains/balance"
+	"github.com/pavlegich/gophermart/internal/domains/ledger"
+	"github.com/pavlegich/gophermart/internal/domains/order"
+	"github.com/pavlegich/gophermart/internal/domains/session"
+	"github.com/pavlegich/gophermart/internal/domains/user"
+)
+
+type AdminService struct {
+	users           user.Repository
+	orders          order.Repository
+	balances        balance.Repository
+	sessions        session.Repository
+	ledger          ledger.Service
+	balancesService balance.Service
+}
+
+func NewAdminService(users user.Repository, orders order.Repository, balances balance.Repository,
+	sessions session.Repository, l ledger.Service) *AdminService {
+	return &AdminService{
+		users:           users,
+		orders:          orders,
+		balances:        balances,
+		sessions:        sessions,
+		ledger:          l,
+		balancesService: balance.NewBalanceService(balances, l),
+	}
+}
+
+// FindUser возвращает пользователя по логину
+func (s *AdminService) FindUser(ctx context.Context, login string) (*user.User, error) {
+	storedUser, err := s.users.GetUserByLogin(ctx, login)
+	if err != nil {
+		return nil, fmt.Errorf("FindUser: get user failed %w", err)
+	}
+	return storedUser, nil
+}
+
+// ListOrders возвращает список заказов любого пользователя
+func (s *AdminService) ListOrders(ctx context.Context, userID int) ([]*order.Order, error) {
+	orders, err := s.orders.GetAllOrders(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ListOrders: get orders list failed %w", err)
+	}
+	return orders, nil
+}
+
+// ListOperations возвращает список операций по балансу любого пользователя
+func (s *AdminService) ListOperations(ctx context.Context, userID int) ([]*balance.Balance, error) {
+	operations, err := s.balances.GetBalanceOperations(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ListOperations: get balance operations failed %w", err)
+	}
+	return operations, nil
+}
+
+// RecheckOrder отправляет заказ на повторную проверку в систему начисления баллов
+func (s *AdminService) RecheckOrder(ctx context.Context, number string) error {
+	if err := s.orders.ResetOrder(ctx, number); err != nil {
+		return fmt.Errorf("RecheckOrder: reset order failed %w", err)
+	}
+	return nil
+}
+
+// ListStaleOrders возвращает заказы, опрос которых в системе начисления баллов остановлен
+func (s *AdminService) ListStaleOrders(ctx context.Context) ([]*order.Job, error) {
+	jobs, err := s.orders.GetStaleJobs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ListStaleOrders: get stale jobs failed %w", err)
+	}
+	return jobs, nil
+}
+
+// RequeueOrder возвращает остановленный заказ в очередь опроса системы начисления баллов
+func (s *AdminService) RequeueOrder(ctx context.Context, number string) error {
+	if err := s.orders.RequeueJob(ctx, number); err != nil {
+		return fmt.Errorf("RequeueOrder: requeue job failed %w", err)
+	}
+	return nil
+}
+
+// BlockUser блокирует учётную запись пользователя и отзывает все его сессии
+func (s *AdminService) BlockUser(ctx context.Context, userID int) error {
+	if err := s.users.SetUserBlocked(ctx, userID, true); err != nil {
+		return fmt.Errorf("BlockUser: block user failed %w", err)
+	}
+	if err := s.sessions.RevokeAllSessions(ctx, userID); err != nil {
+		return fmt.Errorf("BlockUser: revoke sessions failed %w", err)
+	}
+	return nil
+}
+
+// UnblockUser разблокирует учётную запись пользователя
+func (s *AdminService) UnblockUser(ctx context.Context, userID int) error {
+	if err := s.users.SetUserBlocked(ctx, userID, false); err != nil {
+		return fmt.Errorf("UnblockUser: unblock user failed %w", err)
+	}
+	return nil
+}
+
+// AdjustBalance проводит ручную корректировку баланса пользователя
+func (s *AdminService) AdjustBalance(ctx context.Context, b *balance.Balance) error {
+	if _, err := s.users.GetUserByID(ctx, b.UserID); err != nil {
+		return fmt.Errorf("AdjustBalance: get user failed %w", err)
+	}
+	if err := s.balancesService.Adjust(ctx, b); err != nil {
+		return fmt.Errorf("AdjustBalance: adjust balance failed %w", err)
+	}
+	return nil
+}
+
+// ReverseWithdrawal возвращает баллы по списанию пользователя при отмене заказа
+func (s *AdminService) ReverseWithdrawal(ctx context.Context, b *balance.Balance) error {
+	if err := s.balancesService.Reverse(ctx, b); err != nil {
+		return fmt.Errorf("ReverseWithdrawal: reverse withdrawal failed %w", err)
+	}
+	return nil
+}
+
+// VerifyAccounts сверяет счета пользователей с историей операций
+func (s *AdminService) VerifyAccounts(ctx context.Context) ([]*balance.AccountMismatch, error) {
+	mismatches, err := s.balancesService.Verify(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("VerifyAccounts: %w", err)
+	}
+	return mismatches, nil
+}
+
+// TrialBalance проверяет сходимость книги баллов
+func (s *AdminService) TrialBalance(ctx context.Context) (*ledger.TrialBalance, error) {
+	tb, err := s.ledger.TrialBalance(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("TrialBalance: %w", err)
+	}
+	return tb, nil
+}
@@ -2,16 +2,23 @@ package http
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/pavlegich/gophermart/internal/controllers/middlewares"
 	"github.com/pavlegich/gophermart/internal/domains/balance"
 	repo "github.com/pavlegich/gophermart/internal/domains/balance/repository"
+	"github.com/pavlegich/gophermart/internal/domains/idempotency"
+	idempotencyRepo "github.com/pavlegich/gophermart/internal/domains/idempotency/repository"
+	"github.com/pavlegich/gophermart/internal/domains/ledger"
+	ledgerRepo "github.com/pavlegich/gophermart/internal/domains/ledger/repository"
 	errs "github.com/pavlegich/gophermart/internal/errors"
 	"github.com/pavlegich/gophermart/internal/infra/config"
 	"github.com/pavlegich/gophermart/internal/infra/logger"
@@ -26,37 +33,84 @@ type (
 	}
 
 	responseBalance struct {
-		Current   float32 `json:"current"`
-		Withdrawn float32 `json:"withdrawn"`
+		Current   utils.Money `json:"current"`
+		Held      utils.Money `json:"held"`
+		Withdrawn utils.Money `json:"withdrawn"`
+	}
+
+	requestTransfer struct {
+		Login  string      `json:"login"`
+		Amount utils.Money `json:"amount"`
+	}
+
+	responseTransfer struct {
+		ID          int         `json:"id"`
+		Login       string      `json:"login"`
+		Amount      utils.Money `json:"amount"`
+		ProcessedAt string      `json:"processed_at"`
+	}
+
+	responseOperation struct {
+		ID             int         `json:"id"`
+		Action         string      `json:"action"`
+		Amount         utils.Money `json:"amount"`
+		Order          string      `json:"order,omitempty"`
+		Reason         string      `json:"reason,omitempty"`
+		ReversalOf     int         `json:"reversal_of,omitempty"`
+		CounterpartyID int         `json:"counterparty_id,omitempty"`
+		ProcessedAt    string      `json:"processed_at"`
+	}
+
+	responseHistory struct {
+		Operations []responseOperation `json:"operations"`
+		NextCursor string              `json:"next_cursor,omitempty"`
+	}
+
+	responseExpiration struct {
+		Date   string      `json:"date"`
+		Amount utils.Money `json:"amount"`
 	}
 
 	requestWithdraw struct {
-		Order string  `json:"order"`
-		Sum   float32 `json:"sum"`
+		Order string      `json:"order"`
+		Sum   utils.Money `json:"sum"`
 	}
 
 	responseWithdrawal struct {
-		Order       string  `json:"order"`
-		Sum         float32 `json:"sum"`
-		ProcessedAt string  `json:"processed_at"`
+		Order       string      `json:"order"`
+		Sum         utils.Money `json:"sum"`
+		Status      string      `json:"status"`
+		Refunded    utils.Money `json:"refunded,omitempty"`
+		ProcessedAt string      `json:"processed_at"`
 	}
 )
 
 // Activate активирует обработчик запросов для балансов
-func Activate(r *chi.Mux, cfg *config.Config, db *sql.DB) {
-	s := balance.NewBalanceService(repo.NewBalanceRepo(db))
-	newHandler(r, cfg, s)
+func Activate(ctx context.Context, public chi.Router, protected chi.Router, cfg *config.Config, db *sql.DB) {
+	l := ledger.NewLedgerService(ledgerRepo.NewLedgerRepo(db, cfg.PointsExpiry))
+	s := balance.NewBalanceService(repo.NewBalanceRepo(db), l)
+	is := idempotency.NewIdempotencyService(idempotencyRepo.NewIdempotencyRepo(db), cfg.IdempotencyTTL, cfg.IdempotencyLease)
+	newHandler(ctx, public, protected, cfg, s, is)
 }
 
 // newHandler инициализирует обработчик запросов для балансов
-func newHandler(r *chi.Mux, cfg *config.Config, s balance.Service) {
+func newHandler(ctx context.Context, public chi.Router, protected chi.Router, cfg *config.Config, s balance.Service, is idempotency.Service) {
 	h := BalanceHandler{
 		Config:  cfg,
 		Service: s,
 	}
-	r.Get("/api/user/balance", h.HandleBalanceGet)
-	r.Post("/api/user/balance/withdraw", h.HandleBalanceWithdraw)
-	r.Get("/api/user/withdrawals", h.HandleWithdrawalsGet)
+	protected.Get("/api/user/balance", h.HandleBalanceGet)
+	protected.With(middlewares.WithIdempotency(is)).Post("/api/user/balance/withdraw", h.HandleBalanceWithdraw)
+	protected.Get("/api/user/withdrawals", h.HandleWithdrawalsGet)
+	protected.Get("/api/user/balance/expirations", h.HandleExpirationsGet)
+	protected.Get("/api/user/balance/history", h.HandleHistoryGet)
+	protected.With(middlewares.WithIdempotency(is)).Post("/api/user/balance/transfer", h.HandleBalanceTransfer)
+	protected.With(middlewares.WithIdempotency(is)).Post("/api/user/balance/holds", h.HandleHoldCreate)
+	protected.With(middlewares.WithIdempotency(is)).Post("/api/user/balance/holds/{id}/capture", h.HandleHoldCapture)
+	protected.Post("/api/user/balance/holds/{id}/release", h.HandleHoldRelease)
+
+	go workerReleaseHolds(ctx, &h)
+	go workerExpirePoints(ctx, &h)
 }
 
 // HandleBalanceGet обрабатывает запрос получения данных о начислениях и списаниях пользователя
@@ -71,7 +125,7 @@ func (h *BalanceHandler) HandleBalanceGet(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	balanceList, err := h.Service.List(ctx, userID)
+	account, err := h.Service.Get(ctx, userID)
 	if err != nil {
 		logger.Log.With(zap.String("user_id", idString)).Error("HandleBalanceGet: balance get failed",
 			zap.Error(err))
@@ -80,22 +134,9 @@ func (h *BalanceHandler) HandleBalanceGet(w http.ResponseWriter, r *http.Request
 	}
 
 	resp := responseBalance{
-		Current:   0,
-		Withdrawn: 0,
-	}
-
-	for _, b := range balanceList {
-		switch b.Action {
-		case "ACCRUAL":
-			resp.Current += b.Amount
-		case "WITHDRAWAL":
-			resp.Current -= b.Amount
-			resp.Withdrawn += b.Amount
-		default:
-			logger.Log.With(zap.String("user_id", idString)).Error("HandleBalanceGet: action get failed")
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+		Current:   account.Current,
+		Held:      account.Held,
+		Withdrawn: account.Withdrawn,
 	}
 
 	respJSON, err := json.Marshal(resp)
@@ -142,7 +183,7 @@ func (h *BalanceHandler) HandleBalanceWithdraw(w http.ResponseWriter, r *http.Re
 	defer r.Body.Close()
 
 	b := balance.Balance{
-		Action: "WITHDRAWAL",
+		Action: balance.ActionWithdrawal,
 		Amount: req.Sum,
 		UserID: userID,
 		Order:  req.Order,
@@ -151,7 +192,9 @@ func (h *BalanceHandler) HandleBalanceWithdraw(w http.ResponseWriter, r *http.Re
 	if err := h.Service.Withdraw(ctx, &b); err != nil {
 		if errors.Is(err, errs.ErrInsufficientFunds) {
 			w.WriteHeader(http.StatusPaymentRequired)
-		} else if errors.Is(err, errs.ErrIncorrectNumberFormat) {
+		} else if errors.Is(err, errs.ErrWithdrawalExists) {
+			w.WriteHeader(http.StatusConflict)
+		} else if errors.Is(err, errs.ErrIncorrectNumberFormat) || errors.Is(err, errs.ErrIncorrectAmount) {
 			w.WriteHeader(http.StatusUnprocessableEntity)
 		} else {
 			w.WriteHeader(http.StatusInternalServerError)
@@ -164,6 +207,82 @@ func (h *BalanceHandler) HandleBalanceWithdraw(w http.ResponseWriter, r *http.Re
 	w.WriteHeader(http.StatusOK)
 }
 
+// HandleBalanceTransfer обрабатывает запрос о переводе баллов другому пользователю
+func (h *BalanceHandler) HandleBalanceTransfer(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req requestTransfer
+	var buf bytes.Buffer
+
+	userID, err := utils.GetUserIDFromContext(ctx)
+	idString := strconv.Itoa(userID)
+	if err != nil {
+		logger.Log.With(zap.String("user_id", idString)).Error("HandleBalanceTransfer: get user id from context failed")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := buf.ReadFrom(r.Body); err != nil {
+		logger.Log.With(zap.String("user_id", idString)).Error("HandleBalanceTransfer: read request body failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := json.Unmarshal(buf.Bytes(), &req); err != nil {
+		logger.Log.With(zap.String("user_id", idString)).Error("HandleBalanceTransfer: request unmarshal failed",
+			zap.String("body", buf.String()),
+			zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	t := balance.Transfer{
+		SenderID:       userID,
+		RecipientLogin: req.Login,
+		Amount:         req.Amount,
+	}
+	limits := balance.TransferLimits{
+		PerTransfer: utils.NewMoneyFromUnits(int64(h.Config.TransferLimit)),
+		Daily:       utils.NewMoneyFromUnits(int64(h.Config.TransferDaily)),
+	}
+
+	if err := h.Service.Transfer(ctx, &t, limits); err != nil {
+		if errors.Is(err, errs.ErrInsufficientFunds) {
+			w.WriteHeader(http.StatusPaymentRequired)
+		} else if errors.Is(err, errs.ErrUserNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+		} else if errors.Is(err, errs.ErrIncorrectAmount) || errors.Is(err, errs.ErrTransferToSelf) ||
+			errors.Is(err, errs.ErrTransferLimit) || errors.Is(err, errs.ErrUserBlocked) {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		logger.Log.With(zap.String("user_id", idString)).Error("HandleBalanceTransfer: transfer failed",
+			zap.Error(err))
+		return
+	}
+
+	resp := responseTransfer{
+		ID:          t.ID,
+		Login:       t.RecipientLogin,
+		Amount:      t.Amount,
+		ProcessedAt: t.CreatedAt.Format(time.RFC3339),
+	}
+
+	respJSON, err := json.Marshal(resp)
+	if err != nil {
+		logger.Log.With(zap.String("user_id", idString)).Error("HandleBalanceTransfer: response marshal failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(respJSON))
+}
+
 // HandleWithdrawalsGet обрабатывает запрос получения данных о всех списаниях пользователя
 func (h *BalanceHandler) HandleWithdrawalsGet(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -188,18 +307,40 @@ func (h *BalanceHandler) HandleWithdrawalsGet(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	// Суммы возвратов по списаниям
+	refunds := make(map[int]utils.Money)
+	for _, b := range balanceList {
+		if b.Action == balance.ActionReversal {
+			refunds[b.ReversalOf] += b.Amount
+		}
+	}
+
 	resp := make([]responseWithdrawal, 0)
 
 	for _, b := range balanceList {
-		if b.Action == "WITHDRAWAL" {
+		if b.Action == balance.ActionWithdrawal {
+			status := balance.WithdrawalProcessed
+			if refunded := refunds[b.ID]; refunded >= b.Amount {
+				status = balance.WithdrawalRefunded
+			} else if refunded > 0 {
+				status = balance.WithdrawalPartiallyRefunded
+			}
 			resp = append(resp, responseWithdrawal{
 				Order:       b.Order,
 				Sum:         b.Amount,
+				Status:      status,
+				Refunded:    refunds[b.ID],
 				ProcessedAt: b.CreatedAt.Format(time.RFC3339),
 			})
 		}
 	}
 
+	// Начисления и корректировки не являются списаниями
+	if len(resp) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
 	respJSON, err := json.Marshal(resp)
 	if err != nil {
 		logger.Log.With(zap.String("user_id", idString)).Error("HandleWithdrawalsGet: response marshal failed",
@@ -212,3 +353,132 @@ func (h *BalanceHandler) HandleWithdrawalsGet(w http.ResponseWriter, r *http.Req
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(respJSON))
 }
+
+// HandleExpirationsGet обрабатывает запрос получения предстоящих сгораний баллов пользователя по датам
+func (h *BalanceHandler) HandleExpirationsGet(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, err := utils.GetUserIDFromContext(ctx)
+	idString := strconv.Itoa(userID)
+	if err != nil {
+		logger.Log.With(zap.String("user_id", idString)).Error("HandleExpirationsGet: get user id from context failed")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	expirations, err := h.Service.Expirations(ctx, userID)
+	if err != nil {
+		logger.Log.With(zap.String("user_id", idString)).Error("HandleExpirationsGet: get expirations failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if len(expirations) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	resp := make([]responseExpiration, 0, len(expirations))
+	for _, e := range expirations {
+		resp = append(resp, responseExpiration{
+			Date:   e.Date.Format(time.DateOnly),
+			Amount: e.Amount,
+		})
+	}
+
+	respJSON, err := json.Marshal(resp)
+	if err != nil {
+		logger.Log.With(zap.String("user_id", idString)).Error("HandleExpirationsGet: response marshal failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(respJSON))
+}
+
+// HandleHistoryGet обрабатывает запрос получения истории операций по балансу пользователя
+// с постраничной выборкой и фильтрами
+func (h *BalanceHandler) HandleHistoryGet(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, err := utils.GetUserIDFromContext(ctx)
+	idString := strconv.Itoa(userID)
+	if err != nil {
+		logger.Log.With(zap.String("user_id", idString)).Error("HandleHistoryGet: get user id from context failed")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	filter, err := parseHistoryFilter(r)
+	if err != nil {
+		logger.Log.With(zap.String("user_id", idString)).Error("HandleHistoryGet: parse filter failed",
+			zap.String("query", r.URL.RawQuery),
+			zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	operations, next, err := h.Service.History(ctx, userID, filter)
+	if err != nil {
+		if errors.Is(err, errs.ErrIncorrectFilter) {
+			w.WriteHeader(http.StatusBadRequest)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		logger.Log.With(zap.String("user_id", idString)).Error("HandleHistoryGet: get history failed",
+			zap.Error(err))
+		return
+	}
+	if len(operations) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	resp := responseHistory{
+		Operations: make([]responseOperation, 0, len(operations)),
+	}
+	for _, b := range operations {
+		resp.Operations = append(resp.Operations, responseOperation{
+			ID:             b.ID,
+			Action:         b.Action,
+			Amount:         b.Amount,
+			Order:          b.Order,
+			Reason:         b.Reason,
+			ReversalOf:     b.ReversalOf,
+			CounterpartyID: b.CounterpartyID,
+			ProcessedAt:    b.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	if next != nil {
+		resp.NextCursor = next.Encode()
+	}
+
+	respJSON, err := json.Marshal(resp)
+	if err != nil {
+		logger.Log.With(zap.String("user_id", idString)).Error("HandleHistoryGet: response marshal failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(respJSON))
+}
+
+// parseHistoryFilter разбирает параметры запроса истории операций:
+// параметры постраничной выборки и action (через запятую)
+func parseHistoryFilter(r *http.Request) (*balance.HistoryFilter, error) {
+	q := r.URL.Query()
+	page, err := utils.ParsePage(q)
+	if err != nil {
+		return nil, fmt.Errorf("parseHistoryFilter: %w", err)
+	}
+	return &balance.HistoryFilter{
+		Actions: utils.ParseListParam(q, "action"),
+		Page:    page,
+	}, nil
+}
@@ -0,0 +1,145 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pavlegich/gophermart/internal/domains/balance"
+	errs "github.com/pavlegich/gophermart/internal/errors"
+	"github.com/pavlegich/gophermart/internal/infra/logger"
+	"github.com/pavlegich/gophermart/internal/utils"
+	"go.uber.org/zap"
+)
+
+type requestHold struct {
+	Order string      `json:"order"`
+	Sum   utils.Money `json:"sum"`
+}
+
+// HandleHoldCreate обрабатывает запрос о резервировании баллов под оплату заказа
+func (h *BalanceHandler) HandleHoldCreate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req requestHold
+	var buf bytes.Buffer
+
+	userID, err := utils.GetUserIDFromContext(ctx)
+	idString := strconv.Itoa(userID)
+	if err != nil {
+		logger.Log.With(zap.String("user_id", idString)).Error("HandleHoldCreate: get user id from context failed")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := buf.ReadFrom(r.Body); err != nil {
+		logger.Log.With(zap.String("user_id", idString)).Error("HandleHoldCreate: read request body failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := json.Unmarshal(buf.Bytes(), &req); err != nil {
+		logger.Log.With(zap.String("user_id", idString)).Error("HandleHoldCreate: request unmarshal failed",
+			zap.String("body", buf.String()),
+			zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	hold := balance.Hold{
+		UserID:    userID,
+		Order:     req.Order,
+		Amount:    req.Sum,
+		ExpiresAt: time.Now().Add(h.Config.HoldExp),
+	}
+
+	if err := h.Service.Hold(ctx, &hold); err != nil {
+		if errors.Is(err, errs.ErrInsufficientFunds) {
+			w.WriteHeader(http.StatusPaymentRequired)
+		} else if errors.Is(err, errs.ErrIncorrectNumberFormat) || errors.Is(err, errs.ErrIncorrectAmount) {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		logger.Log.With(zap.String("user_id", idString)).Error("HandleHoldCreate: hold failed",
+			zap.Error(err))
+		return
+	}
+
+	writeHold(w, "HandleHoldCreate", http.StatusCreated, &hold)
+}
+
+// HandleHoldCapture обрабатывает запрос о списании зарезервированных баллов
+func (h *BalanceHandler) HandleHoldCapture(w http.ResponseWriter, r *http.Request) {
+	h.handleHoldFinish(w, r, "HandleHoldCapture", h.Service.Capture)
+}
+
+// HandleHoldRelease обрабатывает запрос о возврате зарезервированных баллов
+func (h *BalanceHandler) HandleHoldRelease(w http.ResponseWriter, r *http.Request) {
+	h.handleHoldFinish(w, r, "HandleHoldRelease", h.Service.Release)
+}
+
+// handleHoldFinish завершает резервирование пользователя указанным действием
+func (h *BalanceHandler) handleHoldFinish(w http.ResponseWriter, r *http.Request, handler string,
+	finish func(ctx context.Context, hold *balance.Hold) error) {
+	ctx := r.Context()
+
+	userID, err := utils.GetUserIDFromContext(ctx)
+	idString := strconv.Itoa(userID)
+	if err != nil {
+		logger.Log.With(zap.String("user_id", idString)).Error(handler + ": get user id from context failed")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	holdID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		logger.Log.With(zap.String("user_id", idString)).Error(handler+": convert hold id into integer failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	hold := balance.Hold{
+		ID:     holdID,
+		UserID: userID,
+	}
+
+	if err := finish(ctx, &hold); err != nil {
+		if errors.Is(err, errs.ErrHoldNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+		} else if errors.Is(err, errs.ErrHoldNotActive) || errors.Is(err, errs.ErrHoldExpired) ||
+			errors.Is(err, errs.ErrWithdrawalExists) {
+			w.WriteHeader(http.StatusConflict)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		logger.Log.With(zap.String("user_id", idString)).Error(handler+": finish hold failed",
+			zap.Int("hold_id", holdID),
+			zap.Error(err))
+		return
+	}
+
+	writeHold(w, handler, http.StatusOK, &hold)
+}
+
+// writeHold записывает резервирование в ответ в формате JSON
+func writeHold(w http.ResponseWriter, handler string, status int, hold *balance.Hold) {
+	respJSON, err := json.Marshal(hold)
+	if err != nil {
+		logger.Log.Error(handler+": response marshal failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write([]byte(respJSON))
+}
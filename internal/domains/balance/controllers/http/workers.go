@@ -0,0 +1,55 @@
+package http
+
+import (
+	"context"
+	"time"
+
+	"github.com/pavlegich/gophermart/internal/infra/logger"
+	"go.uber.org/zap"
+)
+
+// workerReleaseHolds периодически возвращает баллы по истёкшим резервированиям
+func workerReleaseHolds(ctx context.Context, h *BalanceHandler) {
+	ticker := time.NewTicker(h.Config.Update)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			released, err := h.Service.ReleaseExpired(ctx)
+			if err != nil {
+				logger.Log.Error("workerReleaseHolds: release expired holds failed",
+					zap.Error(err))
+			}
+			if released > 0 {
+				logger.Log.Info("workerReleaseHolds: expired holds released",
+					zap.Int("count", released))
+			}
+		}
+	}
+}
+
+// workerExpirePoints периодически списывает баллы с истёкшим сроком
+func workerExpirePoints(ctx context.Context, h *BalanceHandler) {
+	ticker := time.NewTicker(h.Config.Update)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			expired, err := h.Service.Expire(ctx)
+			if err != nil {
+				logger.Log.Error("workerExpirePoints: expire points failed",
+					zap.Error(err))
+			}
+			if expired > 0 {
+				logger.Log.Info("workerExpirePoints: expired points written off",
+					zap.Int("users", expired))
+			}
+		}
+	}
+}
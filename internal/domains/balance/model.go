@@ -3,23 +3,145 @@ package balance
 import (
 	"context"
 	"time"
+
+	"github.com/pavlegich/gophermart/internal/domains/ledger"
+	"github.com/pavlegich/gophermart/internal/utils"
+)
+
+// Ограничения размера страницы истории операций
+const (
+	HistoryDefaultLimit = 50
+	HistoryMaxLimit     = 500
+)
+
+// Типы операций по балансу
+const (
+	ActionAccrual     = "ACCRUAL"
+	ActionWithdrawal  = "WITHDRAWAL"
+	ActionAdjustment  = "ADJUSTMENT"
+	ActionReversal    = "REVERSAL"
+	ActionExpiration  = "EXPIRATION"
+	ActionTransferOut = "TRANSFER_OUT"
+	ActionTransferIn  = "TRANSFER_IN"
+)
+
+// Статусы списаний
+const (
+	WithdrawalProcessed         = "PROCESSED"
+	WithdrawalRefunded          = "REFUNDED"
+	WithdrawalPartiallyRefunded = "PARTIALLY_REFUNDED"
 )
 
 type Balance struct {
-	ID        int       `json:"id,omitempty"`
-	Action    string    `json:"action"`
-	Amount    float32   `json:"amount"`
-	UserID    int       `json:"user_id,omitempty"`
-	Order     string    `json:"order"`
-	CreatedAt time.Time `json:"created_at,omitempty"`
+	ID             int         `json:"id,omitempty"`
+	Action         string      `json:"action"`
+	Amount         utils.Money `json:"amount"`
+	UserID         int         `json:"user_id,omitempty"`
+	Order          string      `json:"order"`
+	OperatorID     int         `json:"operator_id,omitempty"`
+	Reason         string      `json:"reason,omitempty"`
+	ReversalOf     int         `json:"reversal_of,omitempty"`
+	CounterpartyID int         `json:"counterparty_id,omitempty"`
+	CreatedAt      time.Time   `json:"created_at,omitempty"`
+}
+
+// Статусы резервирования баллов
+const (
+	HoldActive   = "ACTIVE"
+	HoldCaptured = "CAPTURED"
+	HoldReleased = "RELEASED"
+	HoldExpired  = "EXPIRED"
+)
+
+// Hold хранит резервирование баллов под оплату заказа до его списания или возврата
+type Hold struct {
+	ID        int         `json:"id"`
+	UserID    int         `json:"-"`
+	Order     string      `json:"order"`
+	Amount    utils.Money `json:"sum"`
+	Status    string      `json:"status"`
+	BalanceID int         `json:"-"`
+	ExpiresAt time.Time   `json:"expires_at"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// HistoryFilter хранит условия выборки истории операций по балансу
+type HistoryFilter struct {
+	Actions []string
+	utils.Page
+}
+
+// Transfer хранит перевод баллов другому пользователю
+type Transfer struct {
+	ID             int         `json:"id"`
+	SenderID       int         `json:"-"`
+	RecipientID    int         `json:"-"`
+	RecipientLogin string      `json:"login"`
+	Amount         utils.Money `json:"amount"`
+	CreatedAt      time.Time   `json:"created_at"`
+}
+
+// TransferLimits хранит ограничения на сумму одного перевода и сумму переводов за сутки
+type TransferLimits struct {
+	PerTransfer utils.Money
+	Daily       utils.Money
+}
+
+// Expiration хранит сумму баллов, сгорающих в указанный день
+type Expiration struct {
+	Date   time.Time   `json:"date"`
+	Amount utils.Money `json:"amount"`
+}
+
+// Account хранит доступный баланс пользователя, сумму зарезервированных баллов и сумму списаний
+type Account struct {
+	UserID    int         `json:"user_id"`
+	Current   utils.Money `json:"current"`
+	Held      utils.Money `json:"held"`
+	Withdrawn utils.Money `json:"withdrawn"`
+}
+
+// AccountMismatch хранит расхождение между счётом пользователя и историей операций
+type AccountMismatch struct {
+	UserID          int         `json:"user_id"`
+	Current         utils.Money `json:"current"`
+	Held            utils.Money `json:"held"`
+	Withdrawn       utils.Money `json:"withdrawn"`
+	LedgerCurrent   utils.Money `json:"ledger_current"`
+	LedgerHeld      utils.Money `json:"ledger_held"`
+	LedgerWithdrawn utils.Money `json:"ledger_withdrawn"`
 }
 
 type Service interface {
+	Get(ctx context.Context, userID int) (*Account, error)
 	List(ctx context.Context, userID int) ([]*Balance, error)
 	Withdraw(ctx context.Context, balance *Balance) error
+	Adjust(ctx context.Context, balance *Balance) error
+	Reverse(ctx context.Context, reversal *Balance) error
+	Verify(ctx context.Context) ([]*AccountMismatch, error)
+	Hold(ctx context.Context, hold *Hold) error
+	Capture(ctx context.Context, hold *Hold) error
+	Release(ctx context.Context, hold *Hold) error
+	ReleaseExpired(ctx context.Context) (int, error)
+	Expirations(ctx context.Context, userID int) ([]*Expiration, error)
+	Expire(ctx context.Context) (int, error)
+	Transfer(ctx context.Context, transfer *Transfer, limits TransferLimits) error
+	History(ctx context.Context, userID int, filter *HistoryFilter) ([]*Balance, *utils.Cursor, error)
 }
 
 type Repository interface {
+	GetAccount(ctx context.Context, userID int) (*Account, error)
 	GetBalanceOperations(ctx context.Context, userID int) ([]*Balance, error)
-	UploadWithdrawal(ctx context.Context, balance *Balance) error
+	UploadWithdrawal(ctx context.Context, balance *Balance, post ledger.PostFunc) error
+	UploadAdjustment(ctx context.Context, balance *Balance, post ledger.PostFunc) error
+	UploadReversal(ctx context.Context, reversal *Balance, post ledger.PostFunc) error
+	VerifyAccounts(ctx context.Context) ([]*AccountMismatch, error)
+	UploadHold(ctx context.Context, hold *Hold, post ledger.PostFunc) error
+	CaptureHold(ctx context.Context, hold *Hold, post ledger.PostFunc) error
+	ReleaseHold(ctx context.Context, hold *Hold, post ledger.PostFunc) error
+	ReleaseExpiredHolds(ctx context.Context, post func(ctx context.Context, hold *Hold) error) (int, error)
+	GetUpcomingExpirations(ctx context.Context, userID int) ([]*Expiration, error)
+	ExpirePoints(ctx context.Context, post func(ctx context.Context, balance *Balance) error) (int, error)
+	UploadTransfer(ctx context.Context, transfer *Transfer, dailyLimit utils.Money, post ledger.PostFunc) error
+	GetBalanceHistory(ctx context.Context, userID int, filter *HistoryFilter) ([]*Balance, error)
 }
@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pavlegich/gophermart/internal/domains/balance"
+	"github.com/pavlegich/gophermart/internal/utils"
+)
+
+// expiredUsersBatch количество пользователей со сгорающими баллами, обрабатываемых за один проход
+const expiredUsersBatch = 100
+
+// GetUpcomingExpirations возвращает суммы оставшихся баллов пользователя по датам истечения срока
+func (r *Repository) GetUpcomingExpirations(ctx context.Context, userID int) ([]*balance.Expiration, error) {
+	// Проверка базы данных
+	if err := r.db.PingContext(ctx); err != nil {
+		return nil, fmt.Errorf("GetUpcomingExpirations: connection to database in died %w", err)
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT date_trunc('day', expires_at), SUM(remaining) FROM point_lots 
+	WHERE user_id = $1 AND remaining > 0 AND expires_at IS NOT NULL 
+	GROUP BY 1 ORDER BY 1`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("GetUpcomingExpirations: read rows from table failed %w", err)
+	}
+	defer rows.Close()
+
+	expirations := make([]*balance.Expiration, 0)
+	for rows.Next() {
+		var e balance.Expiration
+		if err := rows.Scan(&e.Date, &e.Amount); err != nil {
+			return nil, fmt.Errorf("GetUpcomingExpirations: scan row failed %w", err)
+		}
+		expirations = append(expirations, &e)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("GetUpcomingExpirations: rows.Err %w", err)
+	}
+
+	return expirations, nil
+}
+
+// ExpirePoints списывает баллы с истёкшим сроком и возвращает количество затронутых пользователей,
+// проводка каждого списания записывается через post
+func (r *Repository) ExpirePoints(ctx context.Context,
+	post func(ctx context.Context, bal *balance.Balance) error) (int, error) {
+	// Проверка базы данных
+	if err := r.db.PingContext(ctx); err != nil {
+		return 0, fmt.Errorf("ExpirePoints: connection to database in died %w", err)
+	}
+
+	// Зарезервированные баллы покрываются самыми старыми партиями и не сгорают,
+	// поэтому выбираются только пользователи, у которых истёкшие партии превышают резерв
+	rows, err := r.db.QueryContext(ctx, `SELECT l.user_id FROM point_lots l 
+	JOIN accounts a ON a.user_id = l.user_id 
+	WHERE l.remaining > 0 AND l.expires_at <= NOW() AND a.current > 0 
+	GROUP BY l.user_id, a.held HAVING SUM(l.remaining) > a.held 
+	LIMIT $1`, expiredUsersBatch)
+	if err != nil {
+		return 0, fmt.Errorf("ExpirePoints: read rows from table failed %w", err)
+	}
+	defer rows.Close()
+
+	users := make([]int, 0)
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			return 0, fmt.Errorf("ExpirePoints: scan row failed %w", err)
+		}
+		users = append(users, userID)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("ExpirePoints: rows.Err %w", err)
+	}
+
+	// Баллы каждого пользователя списываются в отдельной транзакции, ошибка одного не останавливает остальных
+	expired := 0
+	var expireErr error
+	for _, userID := range users {
+		if err := r.expireUserPoints(ctx, userID, post); err != nil {
+			expireErr = fmt.Errorf("ExpirePoints: user %d %w", userID, err)
+			continue
+		}
+		expired++
+	}
+
+	return expired, expireErr
+}
+
+// expireUserPoints списывает баллы пользователя с истёкшим сроком в пределах доступного баланса;
+// захват резерва расходует партии в порядке истечения срока, поэтому резерв покрывается истёкшими
+// партиями в первую очередь и вычитается из сгорающей суммы
+func (r *Repository) expireUserPoints(ctx context.Context, userID int,
+	post func(ctx context.Context, bal *balance.Balance) error) error {
+	// Начало транзакции
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("expireUserPoints: begin transaction failed %w", err)
+	}
+	defer tx.Rollback()
+
+	account, err := lockAccount(ctx, tx, userID)
+	if err != nil {
+		return fmt.Errorf("expireUserPoints: %w", err)
+	}
+
+	bal := balance.Balance{
+		Action: balance.ActionExpiration,
+		UserID: userID,
+	}
+	row := tx.QueryRowContext(ctx, `SELECT COALESCE(SUM(remaining), 0) FROM point_lots 
+	WHERE user_id = $1 AND remaining > 0 AND expires_at <= NOW()`, userID)
+	if err := row.Scan(&bal.Amount); err != nil {
+		return fmt.Errorf("expireUserPoints: scan expired sum failed %w", err)
+	}
+	bal.Amount -= account.Held
+	if bal.Amount > account.Current {
+		bal.Amount = account.Current
+	}
+	if bal.Amount <= 0 {
+		return nil
+	}
+
+	row = tx.QueryRowContext(ctx, `INSERT INTO balances (action, amount, user_id) VALUES ($1, $2, $3) 
+	RETURNING id, created_at`, bal.Action, bal.Amount, bal.UserID)
+	if err := row.Scan(&bal.ID, &bal.CreatedAt); err != nil {
+		return fmt.Errorf("expireUserPoints: insert into table failed %w", err)
+	}
+
+	// Списание в книге расходует партии в порядке истечения срока, то есть в первую очередь истёкшие
+	if err := post(utils.WithTx(ctx, tx), &bal); err != nil {
+		return fmt.Errorf("expireUserPoints: post to ledger failed %w", err)
+	}
+
+	if err := updateAccount(ctx, tx, bal.UserID, -bal.Amount, 0, 0); err != nil {
+		return fmt.Errorf("expireUserPoints: %w", err)
+	}
+
+	// Подтверждение транзакции
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("expireUserPoints: commit transaction failed %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pavlegich/gophermart/internal/domains/balance"
+	"github.com/pavlegich/gophermart/internal/utils"
+)
+
+// GetBalanceHistory возвращает операции пользователя с учётом фильтров, порядка и курсора
+func (r *Repository) GetBalanceHistory(ctx context.Context, userID int, f *balance.HistoryFilter) ([]*balance.Balance, error) {
+	// Проверка базы данных
+	if err := r.db.PingContext(ctx); err != nil {
+		return nil, fmt.Errorf("GetBalanceHistory: connection to database in died %w", err)
+	}
+
+	// Сборка условий запроса
+	var q utils.PageQuery
+	q.Where("user_id = " + q.Arg(userID))
+	if len(f.Actions) > 0 {
+		q.Where("action::text = ANY(" + q.Arg(f.Actions) + "::text[])")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT id, action, amount, user_id, COALESCE(order_number, ''), 
+	COALESCE(operator_id, 0), COALESCE(reason, ''), COALESCE(reversal_of, 0), COALESCE(counterparty_id, 0), 
+	created_at FROM balances WHERE `+q.Page(&f.Page), q.Args...)
+	if err != nil {
+		return nil, fmt.Errorf("GetBalanceHistory: read rows from table failed %w", err)
+	}
+	defer rows.Close()
+
+	operations := make([]*balance.Balance, 0)
+	for rows.Next() {
+		var bal balance.Balance
+		err = rows.Scan(&bal.ID, &bal.Action, &bal.Amount, &bal.UserID, &bal.Order,
+			&bal.OperatorID, &bal.Reason, &bal.ReversalOf, &bal.CounterpartyID, &bal.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("GetBalanceHistory: scan row failed %w", err)
+		}
+		operations = append(operations, &bal)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("GetBalanceHistory: rows.Err %w", err)
+	}
+
+	return operations, nil
+}
@@ -0,0 +1,265 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pavlegich/gophermart/internal/domains/balance"
+	"github.com/pavlegich/gophermart/internal/domains/ledger"
+	errs "github.com/pavlegich/gophermart/internal/errors"
+	"github.com/pavlegich/gophermart/internal/utils"
+)
+
+// expiredHoldsBatch количество истёкших резервирований, обрабатываемых за один проход
+const expiredHoldsBatch = 100
+
+// UploadHold резервирует баллы пользователя под оплату заказа
+func (r *Repository) UploadHold(ctx context.Context, h *balance.Hold, post ledger.PostFunc) error {
+	// Проверка базы данных
+	if err := r.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("UploadHold: connection to database in died %w", err)
+	}
+
+	// Начало транзакции
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("UploadHold: begin transaction failed %w", err)
+	}
+	defer tx.Rollback()
+
+	// Блокировка счёта пользователя и проверка доступного баланса
+	account, err := lockAccount(ctx, tx, h.UserID)
+	if err != nil {
+		return fmt.Errorf("UploadHold: %w", err)
+	}
+	if account.Current < h.Amount {
+		return fmt.Errorf("UploadHold: %w", errs.ErrInsufficientFunds)
+	}
+
+	row := tx.QueryRowContext(ctx, `INSERT INTO holds (user_id, order_number, amount, status, expires_at)
+	VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`,
+		h.UserID, h.Order, h.Amount, h.Status, h.ExpiresAt)
+	if err := row.Scan(&h.ID, &h.CreatedAt); err != nil {
+		return fmt.Errorf("UploadHold: insert into table failed %w", err)
+	}
+
+	// Запись проводки в книгу
+	if err := post(utils.WithTx(ctx, tx)); err != nil {
+		return fmt.Errorf("UploadHold: post to ledger failed %w", err)
+	}
+
+	// Перенос баллов из текущего баланса в зарезервированные
+	if err := updateAccount(ctx, tx, h.UserID, -h.Amount, h.Amount, 0); err != nil {
+		return fmt.Errorf("UploadHold: %w", err)
+	}
+
+	// Подтверждение транзакции
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("UploadHold: commit transaction failed %w", err)
+	}
+
+	return nil
+}
+
+// CaptureHold списывает зарезервированные баллы, создавая операцию списания по заказу
+func (r *Repository) CaptureHold(ctx context.Context, h *balance.Hold, post ledger.PostFunc) error {
+	// Проверка базы данных
+	if err := r.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("CaptureHold: connection to database in died %w", err)
+	}
+
+	// Начало транзакции
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("CaptureHold: begin transaction failed %w", err)
+	}
+	defer tx.Rollback()
+
+	// Блокировка счёта пользователя, затем резервирования
+	if _, err := lockAccount(ctx, tx, h.UserID); err != nil {
+		return fmt.Errorf("CaptureHold: %w", err)
+	}
+	expired, err := lockHold(ctx, tx, h)
+	if err != nil {
+		return fmt.Errorf("CaptureHold: %w", err)
+	}
+	if h.Status != balance.HoldActive {
+		return fmt.Errorf("CaptureHold: %w", errs.ErrHoldNotActive)
+	}
+	if expired {
+		return fmt.Errorf("CaptureHold: %w", errs.ErrHoldExpired)
+	}
+
+	// Списание по заказу
+	var balanceID int
+	row := tx.QueryRowContext(ctx, `INSERT INTO balances
+	(action, amount, user_id, order_number) VALUES ($1, $2, $3, $4)
+	RETURNING id`,
+		balance.ActionWithdrawal, h.Amount, h.UserID, h.Order)
+	if err := row.Scan(&balanceID); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			return fmt.Errorf("CaptureHold: %w", errs.ErrWithdrawalExists)
+		}
+		return fmt.Errorf("CaptureHold: insert into balances failed %w", err)
+	}
+
+	if err := setHoldStatus(ctx, tx, h, balance.HoldCaptured, balanceID); err != nil {
+		return fmt.Errorf("CaptureHold: %w", err)
+	}
+
+	// Запись проводки в книгу
+	if err := post(utils.WithTx(ctx, tx)); err != nil {
+		return fmt.Errorf("CaptureHold: post to ledger failed %w", err)
+	}
+
+	// Перенос зарезервированных баллов в списанные
+	if err := updateAccount(ctx, tx, h.UserID, 0, -h.Amount, h.Amount); err != nil {
+		return fmt.Errorf("CaptureHold: %w", err)
+	}
+
+	// Подтверждение транзакции
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("CaptureHold: commit transaction failed %w", err)
+	}
+
+	return nil
+}
+
+// ReleaseHold возвращает зарезервированные баллы на счёт пользователя
+func (r *Repository) ReleaseHold(ctx context.Context, h *balance.Hold, post ledger.PostFunc) error {
+	// Проверка базы данных
+	if err := r.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("ReleaseHold: connection to database in died %w", err)
+	}
+
+	if err := r.releaseHold(ctx, h, balance.HoldReleased, post); err != nil {
+		return fmt.Errorf("ReleaseHold: %w", err)
+	}
+
+	return nil
+}
+
+// ReleaseExpiredHolds возвращает баллы по истёкшим резервированиям и возвращает их количество,
+// проводка каждого резервирования записывается через post
+func (r *Repository) ReleaseExpiredHolds(ctx context.Context,
+	post func(ctx context.Context, h *balance.Hold) error) (int, error) {
+	// Проверка базы данных
+	if err := r.db.PingContext(ctx); err != nil {
+		return 0, fmt.Errorf("ReleaseExpiredHolds: connection to database in died %w", err)
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT id, user_id FROM holds
+	WHERE status = 'ACTIVE' AND expires_at <= NOW() ORDER BY expires_at LIMIT $1`, expiredHoldsBatch)
+	if err != nil {
+		return 0, fmt.Errorf("ReleaseExpiredHolds: read rows from table failed %w", err)
+	}
+	defer rows.Close()
+
+	holds := make([]*balance.Hold, 0)
+	for rows.Next() {
+		var h balance.Hold
+		if err := rows.Scan(&h.ID, &h.UserID); err != nil {
+			return 0, fmt.Errorf("ReleaseExpiredHolds: scan row failed %w", err)
+		}
+		holds = append(holds, &h)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("ReleaseExpiredHolds: rows.Err %w", err)
+	}
+
+	// Каждое резервирование возвращается в отдельной транзакции, ошибка одного не останавливает остальные
+	released := 0
+	var releaseErr error
+	for _, h := range holds {
+		err := r.releaseHold(ctx, h, balance.HoldExpired, func(ctx context.Context) error {
+			return post(ctx, h)
+		})
+		if err != nil {
+			// Резервирование могло быть списано или возвращено после выборки
+			if !errors.Is(err, errs.ErrHoldNotActive) {
+				releaseErr = fmt.Errorf("ReleaseExpiredHolds: hold %d %w", h.ID, err)
+			}
+			continue
+		}
+		released++
+	}
+
+	return released, releaseErr
+}
+
+// releaseHold возвращает зарезервированные баллы на счёт пользователя и устанавливает статус резервирования
+func (r *Repository) releaseHold(ctx context.Context, h *balance.Hold, status string, post ledger.PostFunc) error {
+	// Начало транзакции
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("releaseHold: begin transaction failed %w", err)
+	}
+	defer tx.Rollback()
+
+	// Блокировка счёта пользователя, затем резервирования
+	if _, err := lockAccount(ctx, tx, h.UserID); err != nil {
+		return fmt.Errorf("releaseHold: %w", err)
+	}
+	if _, err := lockHold(ctx, tx, h); err != nil {
+		return fmt.Errorf("releaseHold: %w", err)
+	}
+	if h.Status != balance.HoldActive {
+		return fmt.Errorf("releaseHold: %w", errs.ErrHoldNotActive)
+	}
+
+	// Запись проводки в книгу
+	if err := post(utils.WithTx(ctx, tx)); err != nil {
+		return fmt.Errorf("releaseHold: post to ledger failed %w", err)
+	}
+
+	if err := setHoldStatus(ctx, tx, h, status, 0); err != nil {
+		return fmt.Errorf("releaseHold: %w", err)
+	}
+
+	// Перенос зарезервированных баллов обратно в текущий баланс
+	if err := updateAccount(ctx, tx, h.UserID, h.Amount, -h.Amount, 0); err != nil {
+		return fmt.Errorf("releaseHold: %w", err)
+	}
+
+	// Подтверждение транзакции
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("releaseHold: commit transaction failed %w", err)
+	}
+
+	return nil
+}
+
+// lockHold читает и блокирует резервирование пользователя до конца транзакции,
+// возвращает признак истечения срока резервирования
+func lockHold(ctx context.Context, tx *sql.Tx, h *balance.Hold) (bool, error) {
+	var expired bool
+	row := tx.QueryRowContext(ctx, `SELECT order_number, amount, status, expires_at, created_at,
+	expires_at <= NOW() FROM holds WHERE id = $1 AND user_id = $2 FOR UPDATE`, h.ID, h.UserID)
+	if err := row.Scan(&h.Order, &h.Amount, &h.Status, &h.ExpiresAt, &h.CreatedAt, &expired); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, fmt.Errorf("lockHold: %w", errs.ErrHoldNotFound)
+		}
+		return false, fmt.Errorf("lockHold: scan hold row failed %w", err)
+	}
+	return expired, nil
+}
+
+// setHoldStatus устанавливает статус резервирования и связанную операцию списания
+func setHoldStatus(ctx context.Context, tx *sql.Tx, h *balance.Hold, status string, balanceID int) error {
+	var balanceIDArg *int
+	if balanceID != 0 {
+		balanceIDArg = &balanceID
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE holds SET status = $1, balance_id = $2, updated_at = NOW()
+	WHERE id = $3`, status, balanceIDArg, h.ID); err != nil {
+		return fmt.Errorf("setHoldStatus: update holds failed %w", err)
+	}
+	h.Status = status
+	h.BalanceID = balanceID
+	return nil
+}
@@ -3,10 +3,15 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/pavlegich/gophermart/internal/domains/balance"
+	"github.com/pavlegich/gophermart/internal/domains/ledger"
 	errs "github.com/pavlegich/gophermart/internal/errors"
+	"github.com/pavlegich/gophermart/internal/utils"
 )
 
 type Repository struct {
@@ -27,8 +32,9 @@ func (r *Repository) GetBalanceOperations(ctx context.Context, userID int) ([]*b
 	}
 
 	// Получение данных заказа
-	rows, err := r.db.QueryContext(ctx, `SELECT id, action, amount, user_id, order_number, created_at 
-	FROM balances WHERE user_id = $1 ORDER BY created_at DESC;`, userID)
+	rows, err := r.db.QueryContext(ctx, `SELECT id, action, amount, user_id, COALESCE(order_number, ''), 
+	COALESCE(operator_id, 0), COALESCE(reason, ''), COALESCE(reversal_of, 0), COALESCE(counterparty_id, 0), 
+	created_at FROM balances WHERE user_id = $1 ORDER BY created_at DESC;`, userID)
 	if err != nil {
 		return nil, fmt.Errorf("GetBalanceOperations: read rows from table failed %w", err)
 	}
@@ -37,7 +43,8 @@ func (r *Repository) GetBalanceOperations(ctx context.Context, userID int) ([]*b
 	storedBalance := make([]*balance.Balance, 0)
 	for rows.Next() {
 		var bal balance.Balance
-		err = rows.Scan(&bal.ID, &bal.Action, &bal.Amount, &bal.UserID, &bal.Order, &bal.CreatedAt)
+		err = rows.Scan(&bal.ID, &bal.Action, &bal.Amount, &bal.UserID, &bal.Order,
+			&bal.OperatorID, &bal.Reason, &bal.ReversalOf, &bal.CounterpartyID, &bal.CreatedAt)
 		if err != nil {
 			return nil, fmt.Errorf("GetBalanceOperations: scan row failed %w", err)
 		}
@@ -53,7 +60,7 @@ func (r *Repository) GetBalanceOperations(ctx context.Context, userID int) ([]*b
 }
 
 // UploadWithdrawal загружает новое списание для заказа пользователя
-func (r *Repository) UploadWithdrawal(ctx context.Context, bal *balance.Balance) error {
+func (r *Repository) UploadWithdrawal(ctx context.Context, bal *balance.Balance, post ledger.PostFunc) error {
 	// Проверка базы данных
 	if err := r.db.PingContext(ctx); err != nil {
 		return fmt.Errorf("UploadWithdrawal: connection to database in died %w", err)
@@ -66,50 +73,264 @@ func (r *Repository) UploadWithdrawal(ctx context.Context, bal *balance.Balance)
 	}
 	defer tx.Rollback()
 
-	// Расчёт текущего баланса
-	rows, err := tx.QueryContext(ctx, `SELECT action, amount FROM balances 
-	WHERE user_id = $1 FOR UPDATE`, bal.UserID)
+	// Блокировка счёта пользователя и проверка баланса
+	account, err := lockAccount(ctx, tx, bal.UserID)
 	if err != nil {
-		return fmt.Errorf("UploadWithdrawal: user opertations get failed %w", err)
+		return fmt.Errorf("UploadWithdrawal: %w", err)
 	}
-	var uBalance float32 = 0
-	for rows.Next() {
-		var uOp struct {
-			action string
-			amount float32
-		}
-		if err := rows.Scan(&uOp.action, &uOp.amount); err != nil {
-			return fmt.Errorf("UploadWithdrawal: scan operation rows failed %w", err)
-		}
 
-		switch uOp.action {
-		case "ACCRUAL":
-			uBalance += uOp.amount
-		case "WITHDRAWAL":
-			uBalance -= uOp.amount
+	if account.Current < bal.Amount {
+		return fmt.Errorf("UploadWithdrawal: %w", errs.ErrInsufficientFunds)
+	}
+
+	// Выполенение запроса для вставки строки с операцией
+	row := tx.QueryRowContext(ctx, `INSERT INTO balances 
+	(action, amount, user_id, order_number) VALUES ($1, $2, $3, $4) 
+	RETURNING id, created_at`,
+		bal.Action, bal.Amount, bal.UserID, bal.Order)
+	if err := row.Scan(&bal.ID, &bal.CreatedAt); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			return fmt.Errorf("UploadWithdrawal: %w", errs.ErrWithdrawalExists)
 		}
+		return fmt.Errorf("UploadWithdrawal: insert into table failed %w", err)
 	}
 
-	err = rows.Err()
+	// Запись проводки в книгу
+	if err := post(utils.WithTx(ctx, tx)); err != nil {
+		return fmt.Errorf("UploadWithdrawal: post to ledger failed %w", err)
+	}
+
+	// Обновление счёта пользователя
+	if err := updateAccount(ctx, tx, bal.UserID, -bal.Amount, 0, bal.Amount); err != nil {
+		return fmt.Errorf("UploadWithdrawal: %w", err)
+	}
+
+	// Подтверждение транзакции
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("UploadWithdrawal: commit transaction failed %w", err)
+	}
+
+	return nil
+}
+
+// UploadAdjustment загружает ручную корректировку баланса пользователя оператором
+func (r *Repository) UploadAdjustment(ctx context.Context, bal *balance.Balance, post ledger.PostFunc) error {
+	// Проверка базы данных
+	if err := r.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("UploadAdjustment: connection to database in died %w", err)
+	}
+
+	// Начало транзакции
+	tx, err := r.db.Begin()
 	if err != nil {
-		return fmt.Errorf("UploadWithdrawal: rows.Err %w", err)
+		return fmt.Errorf("UploadAdjustment: begin transaction failed %w", err)
 	}
+	defer tx.Rollback()
 
-	if uBalance < bal.Amount {
-		return fmt.Errorf("UploadWithdrawal: %w", errs.ErrInsufficientFunds)
+	// Блокировка счёта пользователя, списание не может превышать текущий баланс
+	account, err := lockAccount(ctx, tx, bal.UserID)
+	if err != nil {
+		return fmt.Errorf("UploadAdjustment: %w", err)
+	}
+	if account.Current+bal.Amount < 0 {
+		return fmt.Errorf("UploadAdjustment: %w", errs.ErrInsufficientFunds)
 	}
 
 	// Выполенение запроса для вставки строки с операцией
-	if _, err := tx.ExecContext(ctx, `INSERT INTO balances 
-	(action, amount, user_id, order_number) VALUES ($1, $2, $3, $4);`,
-		bal.Action, bal.Amount, bal.UserID, bal.Order); err != nil {
-		return fmt.Errorf("UploadWithdrawal: insert into table failed %w", err)
+	row := tx.QueryRowContext(ctx, `INSERT INTO balances 
+	(action, amount, user_id, operator_id, reason) VALUES ($1, $2, $3, $4, $5) 
+	RETURNING id, created_at`,
+		bal.Action, bal.Amount, bal.UserID, bal.OperatorID, bal.Reason)
+	if err := row.Scan(&bal.ID, &bal.CreatedAt); err != nil {
+		return fmt.Errorf("UploadAdjustment: insert into table failed %w", err)
+	}
+
+	// Запись проводки в книгу
+	if err := post(utils.WithTx(ctx, tx)); err != nil {
+		return fmt.Errorf("UploadAdjustment: post to ledger failed %w", err)
+	}
+
+	// Обновление счёта пользователя
+	if err := updateAccount(ctx, tx, bal.UserID, bal.Amount, 0, 0); err != nil {
+		return fmt.Errorf("UploadAdjustment: %w", err)
 	}
 
 	// Подтверждение транзакции
 	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("UploadWithdrawal: commit transaction failed %w", err)
+		return fmt.Errorf("UploadAdjustment: commit transaction failed %w", err)
+	}
+
+	return nil
+}
+
+// UploadReversal возвращает на счёт пользователя баллы по ранее проведённому списанию
+func (r *Repository) UploadReversal(ctx context.Context, bal *balance.Balance, post ledger.PostFunc) error {
+	// Проверка базы данных
+	if err := r.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("UploadReversal: connection to database in died %w", err)
+	}
+
+	// Начало транзакции
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("UploadReversal: begin transaction failed %w", err)
+	}
+	defer tx.Rollback()
+
+	// Получение и блокировка исходного списания, чтобы параллельные возвраты не превысили его сумму
+	var withdrawn utils.Money
+	row := tx.QueryRowContext(ctx, `SELECT amount, user_id, COALESCE(order_number, '') FROM balances 
+	WHERE id = $1 AND action = 'WITHDRAWAL' FOR UPDATE`, bal.ReversalOf)
+	if err := row.Scan(&withdrawn, &bal.UserID, &bal.Order); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("UploadReversal: %w", errs.ErrWithdrawalNotFound)
+		}
+		return fmt.Errorf("UploadReversal: scan withdrawal row failed %w", err)
 	}
 
+	// Сумма уже проведённых возвратов по списанию
+	var refunded utils.Money
+	row = tx.QueryRowContext(ctx, `SELECT COALESCE(SUM(amount), 0) FROM balances 
+	WHERE reversal_of = $1 AND action = 'REVERSAL'`, bal.ReversalOf)
+	if err := row.Scan(&refunded); err != nil {
+		return fmt.Errorf("UploadReversal: scan refunded amount failed %w", err)
+	}
+	remaining := withdrawn - refunded
+	if remaining <= 0 {
+		return fmt.Errorf("UploadReversal: %w", errs.ErrWithdrawalReversed)
+	}
+	if bal.Amount == 0 {
+		bal.Amount = remaining
+	}
+	if bal.Amount > remaining {
+		return fmt.Errorf("UploadReversal: %w", errs.ErrIncorrectAmount)
+	}
+
+	// Блокировка счёта пользователя
+	if _, err := lockAccount(ctx, tx, bal.UserID); err != nil {
+		return fmt.Errorf("UploadReversal: %w", err)
+	}
+
+	// Запись возврата
+	row = tx.QueryRowContext(ctx, `INSERT INTO balances 
+	(action, amount, user_id, order_number, operator_id, reason, reversal_of) 
+	VALUES ($1, $2, $3, $4, $5, $6, $7) 
+	RETURNING id, created_at`,
+		bal.Action, bal.Amount, bal.UserID, bal.Order, bal.OperatorID, bal.Reason, bal.ReversalOf)
+	if err := row.Scan(&bal.ID, &bal.CreatedAt); err != nil {
+		return fmt.Errorf("UploadReversal: insert into table failed %w", err)
+	}
+
+	// Запись проводки в книгу
+	if err := post(utils.WithTx(ctx, tx)); err != nil {
+		return fmt.Errorf("UploadReversal: post to ledger failed %w", err)
+	}
+
+	// Обновление счёта пользователя
+	if err := updateAccount(ctx, tx, bal.UserID, bal.Amount, 0, -bal.Amount); err != nil {
+		return fmt.Errorf("UploadReversal: %w", err)
+	}
+
+	// Подтверждение транзакции
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("UploadReversal: commit transaction failed %w", err)
+	}
+
+	return nil
+}
+
+// GetAccount возвращает текущий баланс пользователя
+func (r *Repository) GetAccount(ctx context.Context, userID int) (*balance.Account, error) {
+	// Проверка базы данных
+	if err := r.db.PingContext(ctx); err != nil {
+		return nil, fmt.Errorf("GetAccount: connection to database in died %w", err)
+	}
+
+	// Пользователь без операций имеет нулевой баланс
+	account := balance.Account{UserID: userID}
+	row := r.db.QueryRowContext(ctx, `SELECT current, held, withdrawn FROM accounts WHERE user_id = $1`, userID)
+	err := row.Scan(&account.Current, &account.Held, &account.Withdrawn)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("GetAccount: scan row failed %w", err)
+	}
+
+	return &account, nil
+}
+
+// VerifyAccounts сверяет счета пользователей с суммами по истории операций
+func (r *Repository) VerifyAccounts(ctx context.Context) ([]*balance.AccountMismatch, error) {
+	// Проверка базы данных
+	if err := r.db.PingContext(ctx); err != nil {
+		return nil, fmt.Errorf("VerifyAccounts: connection to database in died %w", err)
+	}
+
+	// Активные резервирования уменьшают текущий баланс на зарезервированную сумму
+	rows, err := r.db.QueryContext(ctx, `WITH ledger AS (
+		SELECT user_id, SUM(current) AS current, SUM(held) AS held, SUM(withdrawn) AS withdrawn FROM (
+			SELECT user_id,
+				CASE WHEN action IN ('WITHDRAWAL', 'EXPIRATION', 'TRANSFER_OUT') THEN -amount ELSE amount END AS current,
+				0 AS held,
+				CASE WHEN action = 'WITHDRAWAL' THEN amount WHEN action = 'REVERSAL' THEN -amount ELSE 0 END AS withdrawn
+			FROM balances WHERE user_id IS NOT NULL 
+			UNION ALL 
+			SELECT user_id, -amount, amount, 0 FROM holds WHERE status = 'ACTIVE'
+		) ops GROUP BY user_id
+	)
+	SELECT COALESCE(a.user_id, l.user_id), COALESCE(a.current, 0), COALESCE(a.held, 0), COALESCE(a.withdrawn, 0), 
+	COALESCE(l.current, 0), COALESCE(l.held, 0), COALESCE(l.withdrawn, 0) 
+	FROM accounts a FULL JOIN ledger l ON l.user_id = a.user_id 
+	WHERE COALESCE(a.current, 0) <> COALESCE(l.current, 0) 
+	OR COALESCE(a.held, 0) <> COALESCE(l.held, 0) 
+	OR COALESCE(a.withdrawn, 0) <> COALESCE(l.withdrawn, 0) 
+	ORDER BY 1`)
+	if err != nil {
+		return nil, fmt.Errorf("VerifyAccounts: read rows from table failed %w", err)
+	}
+	defer rows.Close()
+
+	mismatches := make([]*balance.AccountMismatch, 0)
+	for rows.Next() {
+		var m balance.AccountMismatch
+		if err := rows.Scan(&m.UserID, &m.Current, &m.Held, &m.Withdrawn,
+			&m.LedgerCurrent, &m.LedgerHeld, &m.LedgerWithdrawn); err != nil {
+			return nil, fmt.Errorf("VerifyAccounts: scan row failed %w", err)
+		}
+		mismatches = append(mismatches, &m)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("VerifyAccounts: rows.Err %w", err)
+	}
+
+	return mismatches, nil
+}
+
+// lockAccount создаёт при необходимости и блокирует счёт пользователя до конца транзакции
+func lockAccount(ctx context.Context, tx *sql.Tx, userID int) (*balance.Account, error) {
+	if _, err := tx.ExecContext(ctx, `INSERT INTO accounts (user_id) VALUES ($1) 
+	ON CONFLICT (user_id) DO NOTHING`, userID); err != nil {
+		return nil, fmt.Errorf("lockAccount: insert into accounts failed %w", err)
+	}
+
+	account := balance.Account{UserID: userID}
+	row := tx.QueryRowContext(ctx, `SELECT current, held, withdrawn FROM accounts 
+	WHERE user_id = $1 FOR UPDATE`, userID)
+	if err := row.Scan(&account.Current, &account.Held, &account.Withdrawn); err != nil {
+		return nil, fmt.Errorf("lockAccount: scan account row failed %w", err)
+	}
+
+	return &account, nil
+}
+
+// updateAccount изменяет текущий баланс, сумму зарезервированных баллов и сумму списаний на счёте пользователя
+func updateAccount(ctx context.Context, tx *sql.Tx, userID int, current utils.Money, held utils.Money,
+	withdrawn utils.Money) error {
+	if _, err := tx.ExecContext(ctx, `UPDATE accounts 
+	SET current = current + $2, held = held + $3, withdrawn = withdrawn + $4, updated_at = NOW() 
+	WHERE user_id = $1`, userID, current, held, withdrawn); err != nil {
+		return fmt.Errorf("updateAccount: update accounts failed %w", err)
+	}
 	return nil
 }
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pavlegich/gophermart/internal/domains/balance"
+	errs "github.com/pavlegich/gophermart/internal/errors"
+	"github.com/pavlegich/gophermart/internal/utils"
+)
+
+func TestUploadReversalLimitsRefunds(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   int64
+		refunded string
+		want     error
+	}{
+		{
+			name:     "exceeds_remaining",
+			amount:   6000,
+			refunded: "50.00",
+			want:     errs.ErrIncorrectAmount,
+		},
+		{
+			name:     "fully_refunded",
+			amount:   0,
+			refunded: "100.00",
+			want:     errs.ErrWithdrawalReversed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("create sqlmock failed %v", err)
+			}
+			defer db.Close()
+
+			r := NewBalanceRepo(db)
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta(`WHERE id = $1 AND action = 'WITHDRAWAL' FOR UPDATE`)).WithArgs(3).
+				WillReturnRows(sqlmock.NewRows([]string{"amount", "user_id", "order_number"}).
+					AddRow("100.00", 7, "12345678903"))
+			mock.ExpectQuery(regexp.QuoteMeta(`WHERE reversal_of = $1 AND action = 'REVERSAL'`)).WithArgs(3).
+				WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(tt.refunded))
+			mock.ExpectRollback()
+
+			bal := balance.Balance{Action: balance.ActionReversal, Amount: utils.Money(tt.amount),
+				ReversalOf: 3, OperatorID: 1}
+			post := func(ctx context.Context) error {
+				t.Fatalf("posting must not be written for rejected reversal")
+				return nil
+			}
+			if err := r.UploadReversal(context.Background(), &bal, post); !errors.Is(err, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatalf("unmet expectations %v", err)
+			}
+		})
+	}
+}
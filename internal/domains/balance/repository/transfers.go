@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/pavlegich/gophermart/internal/domains/balance"
+	"github.com/pavlegich/gophermart/internal/domains/ledger"
+	errs "github.com/pavlegich/gophermart/internal/errors"
+	"github.com/pavlegich/gophermart/internal/utils"
+)
+
+// UploadTransfer списывает баллы отправителя и зачисляет их получателю в одной транзакции
+func (r *Repository) UploadTransfer(ctx context.Context, t *balance.Transfer, dailyLimit utils.Money,
+	post ledger.PostFunc) error {
+	// Проверка базы данных
+	if err := r.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("UploadTransfer: connection to database in died %w", err)
+	}
+
+	// Начало транзакции
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("UploadTransfer: begin transaction failed %w", err)
+	}
+	defer tx.Rollback()
+
+	// Поиск получателя, заблокированный пользователь не может получать переводы
+	var blocked bool
+	row := tx.QueryRowContext(ctx, `SELECT id, blocked_at IS NOT NULL FROM users WHERE login = $1`,
+		t.RecipientLogin)
+	if err := row.Scan(&t.RecipientID, &blocked); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("UploadTransfer: %w", errs.ErrUserNotFound)
+		}
+		return fmt.Errorf("UploadTransfer: scan user row failed %w", err)
+	}
+	if blocked {
+		return fmt.Errorf("UploadTransfer: %w", errs.ErrUserBlocked)
+	}
+	if t.RecipientID == t.SenderID {
+		return fmt.Errorf("UploadTransfer: %w", errs.ErrTransferToSelf)
+	}
+
+	// Блокировка счетов в порядке возрастания идентификаторов, чтобы встречные переводы не приводили к взаимоблокировке
+	var sender *balance.Account
+	for _, userID := range orderedPair(t.SenderID, t.RecipientID) {
+		account, err := lockAccount(ctx, tx, userID)
+		if err != nil {
+			return fmt.Errorf("UploadTransfer: %w", err)
+		}
+		if userID == t.SenderID {
+			sender = account
+		}
+	}
+	if sender.Current < t.Amount {
+		return fmt.Errorf("UploadTransfer: %w", errs.ErrInsufficientFunds)
+	}
+
+	// Проверка суммы переводов за сутки
+	if dailyLimit > 0 {
+		var sent utils.Money
+		row := tx.QueryRowContext(ctx, `SELECT COALESCE(SUM(amount), 0) FROM balances 
+		WHERE user_id = $1 AND action = 'TRANSFER_OUT' AND created_at > NOW() - interval '1 day'`, t.SenderID)
+		if err := row.Scan(&sent); err != nil {
+			return fmt.Errorf("UploadTransfer: scan daily sum failed %w", err)
+		}
+		if sent+t.Amount > dailyLimit {
+			return fmt.Errorf("UploadTransfer: %w", errs.ErrTransferLimit)
+		}
+	}
+
+	// Операции списания у отправителя и зачисления получателю
+	row = tx.QueryRowContext(ctx, `INSERT INTO balances (action, amount, user_id, counterparty_id) 
+	VALUES ($1, $2, $3, $4) RETURNING id, created_at`,
+		balance.ActionTransferOut, t.Amount, t.SenderID, t.RecipientID)
+	if err := row.Scan(&t.ID, &t.CreatedAt); err != nil {
+		return fmt.Errorf("UploadTransfer: insert outgoing transfer failed %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO balances (action, amount, user_id, counterparty_id) 
+	VALUES ($1, $2, $3, $4)`,
+		balance.ActionTransferIn, t.Amount, t.RecipientID, t.SenderID); err != nil {
+		return fmt.Errorf("UploadTransfer: insert incoming transfer failed %w", err)
+	}
+
+	// Запись проводки в книгу
+	if err := post(utils.WithTx(ctx, tx)); err != nil {
+		return fmt.Errorf("UploadTransfer: post to ledger failed %w", err)
+	}
+
+	// Обновление счетов отправителя и получателя
+	if err := updateAccount(ctx, tx, t.SenderID, -t.Amount, 0, 0); err != nil {
+		return fmt.Errorf("UploadTransfer: %w", err)
+	}
+	if err := updateAccount(ctx, tx, t.RecipientID, t.Amount, 0, 0); err != nil {
+		return fmt.Errorf("UploadTransfer: %w", err)
+	}
+
+	// Подтверждение транзакции
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("UploadTransfer: commit transaction failed %w", err)
+	}
+
+	return nil
+}
+
+// orderedPair возвращает идентификаторы в порядке возрастания
+func orderedPair(a int, b int) []int {
+	if a > b {
+		return []int{b, a}
+	}
+	return []int{a, b}
+}
@@ -4,21 +4,37 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/pavlegich/gophermart/internal/domains/ledger"
 	errs "github.com/pavlegich/gophermart/internal/errors"
 	"github.com/pavlegich/gophermart/internal/utils"
 )
 
 type BalanceService struct {
-	repo Repository
+	repo   Repository
+	ledger ledger.Service
 }
 
-func NewBalanceService(repo Repository) *BalanceService {
+// NewBalanceService создаёт сервис баланса; проводки операций записываются через сервис книги баллов
+// в транзакции операции
+func NewBalanceService(repo Repository, l ledger.Service) *BalanceService {
 	return &BalanceService{
-		repo: repo,
+		repo:   repo,
+		ledger: l,
 	}
 }
 
+// Get возвращает текущий баланс пользователя
+func (s *BalanceService) Get(ctx context.Context, userID int) (*Account, error) {
+	account, err := s.repo.GetAccount(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("Get: get account failed %w", err)
+	}
+	return account, nil
+}
+
 // List возвращает список поступлений и снятий для пользователя
 func (s *BalanceService) List(ctx context.Context, userID int) ([]*Balance, error) {
 	balanceList, err := s.repo.GetBalanceOperations(ctx, userID)
@@ -33,15 +49,217 @@ func (s *BalanceService) List(ctx context.Context, userID int) ([]*Balance, erro
 
 // Withdraw обрабатывает списание баллов
 func (s *BalanceService) Withdraw(ctx context.Context, b *Balance) error {
-	orderNumber, err := strconv.Atoi(b.Order)
+	if err := validatePayment(b.Order, b.Amount); err != nil {
+		return fmt.Errorf("Withdraw: %w", err)
+	}
+	err := s.repo.UploadWithdrawal(ctx, b, func(ctx context.Context) error {
+		posting := ledger.NewWithdrawal(b.UserID, b.Amount, b.Order)
+		posting.BalanceID = b.ID
+		return s.ledger.Post(ctx, posting)
+	})
+	if err != nil {
+		return fmt.Errorf("Withdraw: upload withdrawal failed %w", err)
+	}
+	return nil
+}
+
+// Adjust обрабатывает ручную корректировку баланса оператором
+func (s *BalanceService) Adjust(ctx context.Context, b *Balance) error {
+	b.Reason = strings.TrimSpace(b.Reason)
+	if b.Amount == 0 || b.Reason == "" || b.OperatorID == 0 {
+		return fmt.Errorf("Adjust: %w", errs.ErrIncorrectAdjustment)
+	}
+	b.Action = ActionAdjustment
+	err := s.repo.UploadAdjustment(ctx, b, func(ctx context.Context) error {
+		posting := ledger.NewAdjustment(b.UserID, b.Amount)
+		posting.BalanceID = b.ID
+		return s.ledger.Post(ctx, posting)
+	})
+	if err != nil {
+		return fmt.Errorf("Adjust: upload adjustment failed %w", err)
+	}
+	return nil
+}
+
+// Reverse возвращает баллы по списанию полностью или частично в пределах невозвращённого остатка,
+// нулевая сумма означает возврат всего остатка
+func (s *BalanceService) Reverse(ctx context.Context, b *Balance) error {
+	b.Reason = strings.TrimSpace(b.Reason)
+	if b.Amount < 0 || b.ReversalOf == 0 || b.OperatorID == 0 {
+		return fmt.Errorf("Reverse: %w", errs.ErrIncorrectAmount)
+	}
+	b.Action = ActionReversal
+	err := s.repo.UploadReversal(ctx, b, func(ctx context.Context) error {
+		posting := ledger.NewReversal(b.UserID, b.Amount, b.Order)
+		posting.BalanceID = b.ID
+		return s.ledger.Post(ctx, posting)
+	})
+	if err != nil {
+		return fmt.Errorf("Reverse: upload reversal failed %w", err)
+	}
+	return nil
+}
+
+// Verify сверяет счета пользователей с историей операций и возвращает найденные расхождения
+func (s *BalanceService) Verify(ctx context.Context) ([]*AccountMismatch, error) {
+	mismatches, err := s.repo.VerifyAccounts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Verify: verify accounts failed %w", err)
+	}
+	return mismatches, nil
+}
+
+// Hold резервирует баллы под оплату заказа до указанного срока
+func (s *BalanceService) Hold(ctx context.Context, h *Hold) error {
+	if err := validatePayment(h.Order, h.Amount); err != nil {
+		return fmt.Errorf("Hold: %w", err)
+	}
+	if !h.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("Hold: %w", errs.ErrHoldExpired)
+	}
+	h.Status = HoldActive
+	err := s.repo.UploadHold(ctx, h, func(ctx context.Context) error {
+		posting := ledger.NewHold(h.UserID, h.Amount, h.Order)
+		posting.HoldID = h.ID
+		return s.ledger.Post(ctx, posting)
+	})
+	if err != nil {
+		return fmt.Errorf("Hold: upload hold failed %w", err)
+	}
+	return nil
+}
+
+// Capture списывает зарезервированные баллы в счёт оплаты заказа
+func (s *BalanceService) Capture(ctx context.Context, h *Hold) error {
+	err := s.repo.CaptureHold(ctx, h, func(ctx context.Context) error {
+		posting := ledger.NewCapture(h.UserID, h.Amount, h.Order)
+		posting.BalanceID = h.BalanceID
+		posting.HoldID = h.ID
+		return s.ledger.Post(ctx, posting)
+	})
+	if err != nil {
+		return fmt.Errorf("Capture: capture hold failed %w", err)
+	}
+	return nil
+}
+
+// Release возвращает зарезервированные баллы на счёт пользователя
+func (s *BalanceService) Release(ctx context.Context, h *Hold) error {
+	err := s.repo.ReleaseHold(ctx, h, func(ctx context.Context) error {
+		return s.postRelease(ctx, h)
+	})
 	if err != nil {
-		return fmt.Errorf("Withdraw: convert into integer failed %w", errs.ErrIncorrectNumberFormat)
+		return fmt.Errorf("Release: release hold failed %w", err)
+	}
+	return nil
+}
+
+// ReleaseExpired возвращает на счета пользователей баллы по истёкшим резервированиям
+func (s *BalanceService) ReleaseExpired(ctx context.Context) (int, error) {
+	released, err := s.repo.ReleaseExpiredHolds(ctx, s.postRelease)
+	if err != nil {
+		return released, fmt.Errorf("ReleaseExpired: release expired holds failed %w", err)
+	}
+	return released, nil
+}
+
+// Expirations возвращает суммы баллов пользователя, которые сгорят, по датам
+func (s *BalanceService) Expirations(ctx context.Context, userID int) ([]*Expiration, error) {
+	expirations, err := s.repo.GetUpcomingExpirations(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("Expirations: get upcoming expirations failed %w", err)
+	}
+	return expirations, nil
+}
+
+// Expire списывает баллы с истёкшим сроком и возвращает количество затронутых пользователей
+func (s *BalanceService) Expire(ctx context.Context) (int, error) {
+	// Назначение срока перенесённым ранее баллам
+	if err := s.ledger.AssignLegacyExpiry(ctx); err != nil {
+		return 0, fmt.Errorf("Expire: %w", err)
+	}
+
+	expired, err := s.repo.ExpirePoints(ctx, func(ctx context.Context, b *Balance) error {
+		posting := ledger.NewExpiration(b.UserID, b.Amount)
+		posting.BalanceID = b.ID
+		return s.ledger.Post(ctx, posting)
+	})
+	if err != nil {
+		return expired, fmt.Errorf("Expire: expire points failed %w", err)
+	}
+	return expired, nil
+}
+
+// Transfer переводит баллы другому пользователю с учётом ограничений на сумму перевода
+func (s *BalanceService) Transfer(ctx context.Context, t *Transfer, limits TransferLimits) error {
+	t.RecipientLogin = strings.TrimSpace(t.RecipientLogin)
+	if t.Amount <= 0 || t.RecipientLogin == "" {
+		return fmt.Errorf("Transfer: %w", errs.ErrIncorrectAmount)
+	}
+	if limits.PerTransfer > 0 && t.Amount > limits.PerTransfer {
+		return fmt.Errorf("Transfer: %w", errs.ErrTransferLimit)
+	}
+	err := s.repo.UploadTransfer(ctx, t, limits.Daily, func(ctx context.Context) error {
+		posting := ledger.NewTransfer(t.SenderID, t.RecipientID, t.Amount)
+		posting.BalanceID = t.ID
+		return s.ledger.Post(ctx, posting)
+	})
+	if err != nil {
+		return fmt.Errorf("Transfer: upload transfer failed %w", err)
+	}
+	return nil
+}
+
+// History возвращает страницу истории операций пользователя и курсор следующей страницы
+func (s *BalanceService) History(ctx context.Context, userID int, f *HistoryFilter) ([]*Balance, *utils.Cursor, error) {
+	for _, action := range f.Actions {
+		if !isAction(action) {
+			return nil, nil, fmt.Errorf("History: unknown action %s %w", action, errs.ErrIncorrectFilter)
+		}
+	}
+	if !f.Normalize(HistoryDefaultLimit, HistoryMaxLimit) {
+		return nil, nil, fmt.Errorf("History: %w", errs.ErrIncorrectFilter)
+	}
+
+	operations, next, err := utils.FetchPage(&f.Page, func() ([]*Balance, error) {
+		return s.repo.GetBalanceHistory(ctx, userID, f)
+	}, func(b *Balance) utils.Cursor {
+		return utils.Cursor{CreatedAt: b.CreatedAt, ID: b.ID}
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("History: get balance history failed %w", err)
+	}
+	return operations, next, nil
+}
+
+// postRelease записывает проводку возврата зарезервированных баллов
+func (s *BalanceService) postRelease(ctx context.Context, h *Hold) error {
+	posting := ledger.NewRelease(h.UserID, h.Amount, h.Order)
+	posting.HoldID = h.ID
+	return s.ledger.Post(ctx, posting)
+}
+
+// isAction проверяет, что тип операции известен
+func isAction(action string) bool {
+	switch action {
+	case ActionAccrual, ActionWithdrawal, ActionAdjustment, ActionReversal,
+		ActionExpiration, ActionTransferOut, ActionTransferIn:
+		return true
+	}
+	return false
+}
+
+// validatePayment проверяет номер заказа и сумму оплаты баллами
+func validatePayment(order string, amount utils.Money) error {
+	orderNumber, err := strconv.Atoi(order)
+	if err != nil {
+		return fmt.Errorf("validatePayment: convert into integer failed %w", errs.ErrIncorrectNumberFormat)
 	}
 	if !utils.LuhnValid(orderNumber) {
-		return fmt.Errorf("Withdraw: luhn check failed %w", errs.ErrIncorrectNumberFormat)
+		return fmt.Errorf("validatePayment: luhn check failed %w", errs.ErrIncorrectNumberFormat)
 	}
-	if err := s.repo.UploadWithdrawal(ctx, b); err != nil {
-		return fmt.Errorf("Withdraw: upload withdrawal failed %w", err)
+	if amount <= 0 {
+		return fmt.Errorf("validatePayment: %w", errs.ErrIncorrectAmount)
 	}
 	return nil
 }
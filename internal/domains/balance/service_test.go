@@ -0,0 +1,52 @@
+package balance
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pavlegich/gophermart/internal/domains/ledger"
+	"github.com/pavlegich/gophermart/internal/utils"
+)
+
+// fakeHoldRepo списывает резервирование и записывает проводку так же, как хранилище внутри транзакции
+type fakeHoldRepo struct {
+	Repository
+}
+
+func (f *fakeHoldRepo) CaptureHold(ctx context.Context, h *Hold, post ledger.PostFunc) error {
+	h.Status = HoldCaptured
+	h.BalanceID = 11
+	return post(ctx)
+}
+
+// fakeLedger запоминает записанные проводки
+type fakeLedger struct {
+	ledger.Service
+	postings []*ledger.Posting
+}
+
+func (f *fakeLedger) Post(ctx context.Context, p *ledger.Posting) error {
+	f.postings = append(f.postings, p)
+	return nil
+}
+
+func TestCapturePostsThroughLedger(t *testing.T) {
+	l := &fakeLedger{}
+	s := NewBalanceService(&fakeHoldRepo{}, l)
+
+	h := &Hold{ID: 5, UserID: 7, Order: "12345678903", Amount: utils.NewMoneyFromUnits(10)}
+	if err := s.Capture(context.Background(), h); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if len(l.postings) != 1 {
+		t.Fatalf("expected one posting, got %d", len(l.postings))
+	}
+	p := l.postings[0]
+	if p.Kind != ledger.KindCapture || p.BalanceID != 11 || p.HoldID != 5 {
+		t.Fatalf("expected capture posting for balance 11 and hold 5, got %+v", p)
+	}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("expected balanced posting, got %v", err)
+	}
+}
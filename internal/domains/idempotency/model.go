@@ -0,0 +1,29 @@
+package idempotency
+
+import (
+	"context"
+	"time"
+)
+
+// Record хранит отпечаток запроса с ключом идемпотентности и сохранённый ответ на него
+type Record struct {
+	UserID      int
+	Key         string
+	Fingerprint string
+	Status      int
+	ContentType string
+	Body        []byte
+	CreatedAt   time.Time
+}
+
+type Service interface {
+	Begin(ctx context.Context, record *Record) (*Record, error)
+	Complete(ctx context.Context, record *Record) error
+	Release(ctx context.Context, record *Record) error
+}
+
+type Repository interface {
+	AcquireKey(ctx context.Context, record *Record, ttl time.Duration, lease time.Duration) (*Record, bool, error)
+	SaveResponse(ctx context.Context, record *Record) error
+	DeleteKey(ctx context.Context, record *Record) error
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pavlegich/gophermart/internal/domains/idempotency"
+)
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewIdempotencyRepo(db *sql.DB) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+// AcquireKey закрепляет ключ за запросом на время lease, если ключ свободен, срок его хранения истёк
+// или запрос без ответа не завершился за время аренды; иначе возвращает сохранённую запись
+func (r *Repository) AcquireKey(ctx context.Context, rec *idempotency.Record,
+	ttl time.Duration, lease time.Duration) (*idempotency.Record, bool, error) {
+	// Проверка базы данных
+	if err := r.db.PingContext(ctx); err != nil {
+		return nil, false, fmt.Errorf("AcquireKey: connection to database in died %w", err)
+	}
+
+	// Вставка нового ключа или перезапись устаревшего либо брошенного без ответа
+	row := r.db.QueryRowContext(ctx, `INSERT INTO idempotency_keys (user_id, key, fingerprint, locked_until) 
+	VALUES ($1, $2, $3, NOW() + make_interval(secs => $5)) 
+	ON CONFLICT (user_id, key) DO UPDATE 
+	SET fingerprint = EXCLUDED.fingerprint, status = NULL, content_type = NULL, body = NULL, 
+	locked_until = EXCLUDED.locked_until, created_at = NOW() 
+	WHERE idempotency_keys.created_at < NOW() - make_interval(secs => $4) 
+	OR (idempotency_keys.status IS NULL AND idempotency_keys.locked_until < NOW()) 
+	RETURNING created_at`, rec.UserID, rec.Key, rec.Fingerprint, int64(ttl.Seconds()), lease.Seconds())
+	err := row.Scan(&rec.CreatedAt)
+	if err == nil {
+		return nil, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, fmt.Errorf("AcquireKey: insert into table failed %w", err)
+	}
+
+	// Ключ уже используется
+	var stored idempotency.Record
+	var status sql.NullInt64
+	var contentType sql.NullString
+	row = r.db.QueryRowContext(ctx, `SELECT user_id, key, fingerprint, status, content_type, body, created_at 
+	FROM idempotency_keys WHERE user_id = $1 AND key = $2`, rec.UserID, rec.Key)
+	if err := row.Scan(&stored.UserID, &stored.Key, &stored.Fingerprint, &status, &contentType,
+		&stored.Body, &stored.CreatedAt); err != nil {
+		return nil, false, fmt.Errorf("AcquireKey: scan row failed %w", err)
+	}
+	stored.Status = int(status.Int64)
+	stored.ContentType = contentType.String
+
+	return &stored, false, nil
+}
+
+// SaveResponse сохраняет ответ на запрос с ключом идемпотентности
+func (r *Repository) SaveResponse(ctx context.Context, rec *idempotency.Record) error {
+	// Проверка базы данных
+	if err := r.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("SaveResponse: connection to database in died %w", err)
+	}
+
+	// Ключ, перехваченный другим запросом после истечения аренды, не перезаписывается
+	if _, err := r.db.ExecContext(ctx, `UPDATE idempotency_keys SET status = $1, content_type = $2, body = $3, 
+	locked_until = NULL WHERE user_id = $4 AND key = $5 AND created_at = $6`,
+		rec.Status, rec.ContentType, rec.Body, rec.UserID, rec.Key, rec.CreatedAt); err != nil {
+		return fmt.Errorf("SaveResponse: update table failed %w", err)
+	}
+
+	return nil
+}
+
+// DeleteKey удаляет ключ идемпотентности, если он всё ещё закреплён за запросом
+func (r *Repository) DeleteKey(ctx context.Context, rec *idempotency.Record) error {
+	// Проверка базы данных
+	if err := r.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("DeleteKey: connection to database in died %w", err)
+	}
+
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM idempotency_keys 
+	WHERE user_id = $1 AND key = $2 AND created_at = $3`, rec.UserID, rec.Key, rec.CreatedAt); err != nil {
+		return fmt.Errorf("DeleteKey: delete from table failed %w", err)
+	}
+
+	return nil
+}
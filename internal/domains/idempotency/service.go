@@ -0,0 +1,60 @@
+package idempotency
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	errs "github.com/pavlegich/gophermart/internal/errors"
+)
+
+type IdempotencyService struct {
+	repo  Repository
+	ttl   time.Duration
+	lease time.Duration
+}
+
+// NewIdempotencyService создаёт сервис ключей идемпотентности: ответ хранится ttl,
+// ключ запроса без ответа (например, после падения процесса) освобождается через lease
+func NewIdempotencyService(repo Repository, ttl time.Duration, lease time.Duration) *IdempotencyService {
+	return &IdempotencyService{
+		repo:  repo,
+		ttl:   ttl,
+		lease: lease,
+	}
+}
+
+// Begin закрепляет ключ за запросом; если ключ уже использован тем же запросом,
+// возвращает сохранённый ответ для повтора
+func (s *IdempotencyService) Begin(ctx context.Context, rec *Record) (*Record, error) {
+	stored, acquired, err := s.repo.AcquireKey(ctx, rec, s.ttl, s.lease)
+	if err != nil {
+		return nil, fmt.Errorf("Begin: acquire key failed %w", err)
+	}
+	if acquired {
+		return nil, nil
+	}
+	if stored.Fingerprint != rec.Fingerprint {
+		return nil, fmt.Errorf("Begin: %w", errs.ErrIdempotencyKeyMismatch)
+	}
+	if stored.Status == 0 {
+		return nil, fmt.Errorf("Begin: %w", errs.ErrIdempotencyKeyInProgress)
+	}
+	return stored, nil
+}
+
+// Complete сохраняет ответ на запрос с ключом идемпотентности
+func (s *IdempotencyService) Complete(ctx context.Context, rec *Record) error {
+	if err := s.repo.SaveResponse(ctx, rec); err != nil {
+		return fmt.Errorf("Complete: save response failed %w", err)
+	}
+	return nil
+}
+
+// Release освобождает ключ, чтобы запрос можно было повторить
+func (s *IdempotencyService) Release(ctx context.Context, rec *Record) error {
+	if err := s.repo.DeleteKey(ctx, rec); err != nil {
+		return fmt.Errorf("Release: delete key failed %w", err)
+	}
+	return nil
+}
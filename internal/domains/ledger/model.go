@@ -0,0 +1,250 @@
+package ledger
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	errs "github.com/pavlegich/gophermart/internal/errors"
+	"github.com/pavlegich/gophermart/internal/utils"
+)
+
+// Системные счета баллов
+const (
+	AccountIssued   = "system:issued"
+	AccountRedeemed = "system:redeemed"
+	AccountExpired  = "system:expired"
+)
+
+// Типы проводок
+const (
+	KindAccrual    = "ACCRUAL"
+	KindWithdrawal = "WITHDRAWAL"
+	KindAdjustment = "ADJUSTMENT"
+	KindHold       = "HOLD"
+	KindCapture    = "CAPTURE"
+	KindRelease    = "RELEASE"
+	KindReversal   = "REVERSAL"
+	KindExpiration = "EXPIRATION"
+	KindTransfer   = "TRANSFER"
+)
+
+// Entry хранит движение баллов по одному счёту, положительная сумма увеличивает баланс счёта
+type Entry struct {
+	Account string      `json:"account"`
+	UserID  int         `json:"user_id,omitempty"`
+	Amount  utils.Money `json:"amount"`
+}
+
+// Posting хранит сбалансированный набор движений между счетами
+type Posting struct {
+	ID        int       `json:"id"`
+	Kind      string    `json:"kind"`
+	Reference string    `json:"reference,omitempty"`
+	BalanceID int       `json:"balance_id,omitempty"`
+	HoldID    int       `json:"hold_id,omitempty"`
+	Entries   []Entry   `json:"entries"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Lot хранит партию начисленных баллов, списываемую в порядке истечения срока
+type Lot struct {
+	ID        int         `json:"id"`
+	UserID    int         `json:"user_id"`
+	PostingID int         `json:"posting_id"`
+	Amount    utils.Money `json:"amount"`
+	Remaining utils.Money `json:"remaining"`
+	ExpiresAt *time.Time  `json:"expires_at,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// AccountBalance хранит баланс счёта или группы счетов
+type AccountBalance struct {
+	Account string      `json:"account"`
+	Balance utils.Money `json:"balance"`
+}
+
+// TrialBalance хранит результат проверки сходимости книги
+type TrialBalance struct {
+	Balanced           bool              `json:"balanced"`
+	Total              utils.Money       `json:"total"`
+	Accounts           []*AccountBalance `json:"accounts"`
+	UnbalancedPostings []int             `json:"unbalanced_postings"`
+	MismatchedAccounts []string          `json:"mismatched_accounts"`
+}
+
+// PostFunc записывает проводку операции через книгу баллов; хранилище операции вызывает её
+// внутри своей транзакции и передаёт транзакцию в контексте
+type PostFunc func(ctx context.Context) error
+
+type Service interface {
+	Post(ctx context.Context, posting *Posting) error
+	AssignLegacyExpiry(ctx context.Context) error
+	TrialBalance(ctx context.Context) (*TrialBalance, error)
+}
+
+type Repository interface {
+	Post(ctx context.Context, posting *Posting) error
+	AssignLegacyExpiry(ctx context.Context) error
+	GetTrialBalance(ctx context.Context) (*TrialBalance, error)
+}
+
+// Validate проверяет, что проводка содержит не менее двух ненулевых движений с нулевой суммой
+func (p *Posting) Validate() error {
+	if len(p.Entries) < 2 {
+		return fmt.Errorf("Validate: %w", errs.ErrPostingUnbalanced)
+	}
+	var total utils.Money
+	for _, e := range p.Entries {
+		if e.Amount == 0 || e.Account == "" {
+			return fmt.Errorf("Validate: %w", errs.ErrPostingUnbalanced)
+		}
+		total += e.Amount
+	}
+	if total != 0 {
+		return fmt.Errorf("Validate: %w", errs.ErrPostingUnbalanced)
+	}
+	return nil
+}
+
+// UserMovements возвращает чистое движение баллов каждого пользователя по проводке в порядке появления;
+// перемещения между счетами одного пользователя (резервирование) взаимно погашаются
+func (p *Posting) UserMovements() ([]int, map[int]utils.Money) {
+	users := make([]int, 0)
+	net := make(map[int]utils.Money)
+	for _, e := range p.Entries {
+		if e.UserID == 0 {
+			continue
+		}
+		if _, ok := net[e.UserID]; !ok {
+			users = append(users, e.UserID)
+		}
+		net[e.UserID] += e.Amount
+	}
+	return users, net
+}
+
+// UserAccount возвращает код счёта баллов пользователя
+func UserAccount(userID int) string {
+	return "user:" + strconv.Itoa(userID)
+}
+
+// UserHeldAccount возвращает код счёта зарезервированных баллов пользователя
+func UserHeldAccount(userID int) string {
+	return UserAccount(userID) + ":held"
+}
+
+// userEntry возвращает движение по счёту пользователя
+func userEntry(userID int, amount utils.Money) Entry {
+	return Entry{
+		Account: UserAccount(userID),
+		UserID:  userID,
+		Amount:  amount,
+	}
+}
+
+// NewAccrual возвращает проводку начисления баллов за заказ
+func NewAccrual(userID int, amount utils.Money, order string) *Posting {
+	return &Posting{
+		Kind:      KindAccrual,
+		Reference: order,
+		Entries: []Entry{
+			userEntry(userID, amount),
+			{Account: AccountIssued, Amount: -amount},
+		},
+	}
+}
+
+// NewWithdrawal возвращает проводку списания баллов в счёт оплаты заказа
+func NewWithdrawal(userID int, amount utils.Money, order string) *Posting {
+	return &Posting{
+		Kind:      KindWithdrawal,
+		Reference: order,
+		Entries: []Entry{
+			userEntry(userID, -amount),
+			{Account: AccountRedeemed, Amount: amount},
+		},
+	}
+}
+
+// NewAdjustment возвращает проводку ручной корректировки баланса, сумма может быть отрицательной
+func NewAdjustment(userID int, amount utils.Money) *Posting {
+	return &Posting{
+		Kind: KindAdjustment,
+		Entries: []Entry{
+			userEntry(userID, amount),
+			{Account: AccountIssued, Amount: -amount},
+		},
+	}
+}
+
+// NewHold возвращает проводку резервирования баллов пользователя под оплату заказа
+func NewHold(userID int, amount utils.Money, order string) *Posting {
+	return &Posting{
+		Kind:      KindHold,
+		Reference: order,
+		Entries: []Entry{
+			userEntry(userID, -amount),
+			{Account: UserHeldAccount(userID), UserID: userID, Amount: amount},
+		},
+	}
+}
+
+// NewCapture возвращает проводку списания зарезервированных баллов в счёт оплаты заказа
+func NewCapture(userID int, amount utils.Money, order string) *Posting {
+	return &Posting{
+		Kind:      KindCapture,
+		Reference: order,
+		Entries: []Entry{
+			{Account: UserHeldAccount(userID), UserID: userID, Amount: -amount},
+			{Account: AccountRedeemed, Amount: amount},
+		},
+	}
+}
+
+// NewRelease возвращает проводку возврата зарезервированных баллов на счёт пользователя
+func NewRelease(userID int, amount utils.Money, order string) *Posting {
+	return &Posting{
+		Kind:      KindRelease,
+		Reference: order,
+		Entries: []Entry{
+			{Account: UserHeldAccount(userID), UserID: userID, Amount: -amount},
+			userEntry(userID, amount),
+		},
+	}
+}
+
+// NewReversal возвращает проводку возврата списанных баллов при отмене оплаченного заказа
+func NewReversal(userID int, amount utils.Money, order string) *Posting {
+	return &Posting{
+		Kind:      KindReversal,
+		Reference: order,
+		Entries: []Entry{
+			userEntry(userID, amount),
+			{Account: AccountRedeemed, Amount: -amount},
+		},
+	}
+}
+
+// NewExpiration возвращает проводку списания баллов с истёкшим сроком
+func NewExpiration(userID int, amount utils.Money) *Posting {
+	return &Posting{
+		Kind: KindExpiration,
+		Entries: []Entry{
+			userEntry(userID, -amount),
+			{Account: AccountExpired, Amount: amount},
+		},
+	}
+}
+
+// NewTransfer возвращает проводку перевода баллов между пользователями
+func NewTransfer(senderID int, recipientID int, amount utils.Money) *Posting {
+	return &Posting{
+		Kind: KindTransfer,
+		Entries: []Entry{
+			userEntry(senderID, -amount),
+			userEntry(recipientID, amount),
+		},
+	}
+}
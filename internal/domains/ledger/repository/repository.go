@@ -0,0 +1,321 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/pavlegich/gophermart/internal/domains/ledger"
+	"github.com/pavlegich/gophermart/internal/utils"
+)
+
+type Repository struct {
+	db           *sql.DB
+	expiryMonths int
+}
+
+// NewLedgerRepo создаёт хранилище книги баллов; начисленные баллы сгорают через expiryMonths месяцев,
+// при нулевом значении срок не ограничен
+func NewLedgerRepo(db *sql.DB, expiryMonths int) *Repository {
+	return &Repository{
+		db:           db,
+		expiryMonths: expiryMonths,
+	}
+}
+
+// Post записывает проводку в рамках транзакции операции, переданной в контексте
+func (r *Repository) Post(ctx context.Context, p *ledger.Posting) error {
+	tx, err := utils.GetTxFromContext(ctx)
+	if err != nil {
+		return fmt.Errorf("Post: %w", err)
+	}
+
+	if err := r.insertPosting(ctx, tx, p); err != nil {
+		return fmt.Errorf("Post: insert posting failed %w", err)
+	}
+
+	// Расход списывает партии пользователя по порядку истечения
+	users, net := p.UserMovements()
+	consumed := make([]*ledger.Lot, 0)
+	for _, userID := range users {
+		if amount := net[userID]; amount < 0 {
+			slices, err := r.consumeLots(ctx, tx, userID, -amount)
+			if err != nil {
+				return fmt.Errorf("Post: consume lots failed %w", err)
+			}
+			consumed = append(consumed, slices...)
+		}
+	}
+
+	// Поступление баллов создаёт партии: баллы, переданные другим пользователем, сохраняют срок
+	// списанных партий, остальные получают новый срок
+	for _, userID := range users {
+		amount := net[userID]
+		if amount <= 0 {
+			continue
+		}
+		for len(consumed) > 0 && amount > 0 {
+			slice := consumed[0]
+			part := slice.Remaining
+			if part > amount {
+				part = amount
+			}
+			lot := ledger.Lot{
+				UserID:    userID,
+				PostingID: p.ID,
+				Amount:    part,
+				Remaining: part,
+				ExpiresAt: slice.ExpiresAt,
+			}
+			if lot.ExpiresAt == nil {
+				lot.ExpiresAt = r.newExpiry()
+			}
+			if err := r.insertLot(ctx, tx, &lot); err != nil {
+				return fmt.Errorf("Post: insert lot failed %w", err)
+			}
+			slice.Remaining -= part
+			if slice.Remaining == 0 {
+				consumed = consumed[1:]
+			}
+			amount -= part
+		}
+		if amount <= 0 {
+			continue
+		}
+
+		lot := ledger.Lot{
+			UserID:    userID,
+			PostingID: p.ID,
+			Amount:    amount,
+			Remaining: amount,
+			ExpiresAt: r.newExpiry(),
+		}
+		if err := r.insertLot(ctx, tx, &lot); err != nil {
+			return fmt.Errorf("Post: insert lot failed %w", err)
+		}
+	}
+	return nil
+}
+
+// newExpiry возвращает срок истечения новой партии или nil, если срок не ограничен
+func (r *Repository) newExpiry() *time.Time {
+	if r.expiryMonths <= 0 {
+		return nil
+	}
+	expiresAt := time.Now().AddDate(0, r.expiryMonths, 0)
+	return &expiresAt
+}
+
+// AssignLegacyExpiry назначает срок истечения партиям, перенесённым из накопленных ранее баллов,
+// отсчитывая его от даты переноса
+func (r *Repository) AssignLegacyExpiry(ctx context.Context) error {
+	if r.expiryMonths <= 0 {
+		return nil
+	}
+	if _, err := r.db.ExecContext(ctx, `UPDATE point_lots 
+	SET expires_at = created_at + make_interval(months => $1) 
+	WHERE posting_id IS NULL AND expires_at IS NULL`, r.expiryMonths); err != nil {
+		return fmt.Errorf("AssignLegacyExpiry: update point_lots failed %w", err)
+	}
+	return nil
+}
+
+// insertPosting записывает проводку и её движения в рамках транзакции;
+// баланс хранится только у счетов пользователей, счёт которых уже заблокирован вызывающим,
+// балансы общих системных счетов вычисляются по движениям, чтобы не блокировать их строки
+func (r *Repository) insertPosting(ctx context.Context, tx *sql.Tx, p *ledger.Posting) error {
+	// Сохранение проводки
+	var balanceID, holdID *int
+	if p.BalanceID != 0 {
+		balanceID = &p.BalanceID
+	}
+	if p.HoldID != 0 {
+		holdID = &p.HoldID
+	}
+	row := tx.QueryRowContext(ctx, `INSERT INTO ledger_postings (kind, reference, balance_id, hold_id) 
+	VALUES ($1, $2, $3, $4) RETURNING id, created_at`, p.Kind, p.Reference, balanceID, holdID)
+	if err := row.Scan(&p.ID, &p.CreatedAt); err != nil {
+		return fmt.Errorf("insertPosting: insert into ledger_postings failed %w", err)
+	}
+
+	for _, e := range p.Entries {
+		var userID *int
+		if e.UserID != 0 {
+			userID = &e.UserID
+		}
+
+		// Создание счёта при необходимости и изменение баланса счёта пользователя
+		var accountID int
+		var row *sql.Row
+		if userID != nil {
+			row = tx.QueryRowContext(ctx, `INSERT INTO ledger_accounts (code, user_id, balance) 
+			VALUES ($1, $2, $3) 
+			ON CONFLICT (code) DO UPDATE SET balance = ledger_accounts.balance + EXCLUDED.balance 
+			RETURNING id`, e.Account, userID, e.Amount)
+		} else {
+			row = tx.QueryRowContext(ctx, `WITH created AS (
+				INSERT INTO ledger_accounts (code) VALUES ($1) ON CONFLICT (code) DO NOTHING RETURNING id
+			)
+			SELECT id FROM created UNION ALL SELECT id FROM ledger_accounts WHERE code = $1 LIMIT 1`, e.Account)
+		}
+		if err := row.Scan(&accountID); err != nil {
+			return fmt.Errorf("insertPosting: update ledger_accounts failed %w", err)
+		}
+
+		// Сохранение движения по счёту
+		if _, err := tx.ExecContext(ctx, `INSERT INTO ledger_entries (posting_id, account_id, amount) 
+		VALUES ($1, $2, $3)`, p.ID, accountID, e.Amount); err != nil {
+			return fmt.Errorf("insertPosting: insert into ledger_entries failed %w", err)
+		}
+	}
+
+	return nil
+}
+
+// insertLot сохраняет партию начисленных баллов в рамках транзакции
+func (r *Repository) insertLot(ctx context.Context, tx *sql.Tx, lot *ledger.Lot) error {
+	row := tx.QueryRowContext(ctx, `INSERT INTO point_lots (user_id, posting_id, amount, remaining, expires_at) 
+	VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`,
+		lot.UserID, lot.PostingID, lot.Amount, lot.Remaining, lot.ExpiresAt)
+	if err := row.Scan(&lot.ID, &lot.CreatedAt); err != nil {
+		return fmt.Errorf("insertLot: insert into point_lots failed %w", err)
+	}
+	return nil
+}
+
+// consumeLots списывает сумму с партий пользователя в порядке истечения срока (FIFO)
+// и возвращает списанные части партий с их сроками
+func (r *Repository) consumeLots(ctx context.Context, tx *sql.Tx, userID int,
+	amount utils.Money) ([]*ledger.Lot, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT id, remaining, expires_at FROM point_lots 
+	WHERE user_id = $1 AND remaining > 0 
+	ORDER BY expires_at NULLS LAST, id FOR UPDATE`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("consumeLots: read rows from table failed %w", err)
+	}
+	defer rows.Close()
+
+	lots := make([]*ledger.Lot, 0)
+	for rows.Next() {
+		lot := ledger.Lot{UserID: userID}
+		if err := rows.Scan(&lot.ID, &lot.Remaining, &lot.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("consumeLots: scan row failed %w", err)
+		}
+		lots = append(lots, &lot)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("consumeLots: rows.Err %w", err)
+	}
+	rows.Close()
+
+	slices := make([]*ledger.Lot, 0)
+	for _, lot := range lots {
+		if amount <= 0 {
+			break
+		}
+		consumed := lot.Remaining
+		if consumed > amount {
+			consumed = amount
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE point_lots SET remaining = remaining - $1 WHERE id = $2`,
+			consumed, lot.ID); err != nil {
+			return nil, fmt.Errorf("consumeLots: update point_lots failed %w", err)
+		}
+		lot.Amount = consumed
+		lot.Remaining = consumed
+		slices = append(slices, lot)
+		amount -= consumed
+	}
+
+	return slices, nil
+}
+
+// GetTrialBalance собирает данные для проверки сходимости книги
+func (r *Repository) GetTrialBalance(ctx context.Context) (*ledger.TrialBalance, error) {
+	// Проверка базы данных
+	if err := r.db.PingContext(ctx); err != nil {
+		return nil, fmt.Errorf("GetTrialBalance: connection to database in died %w", err)
+	}
+
+	tb := ledger.TrialBalance{
+		Accounts:           make([]*ledger.AccountBalance, 0),
+		UnbalancedPostings: make([]int, 0),
+		MismatchedAccounts: make([]string, 0),
+	}
+
+	// Балансы системных счетов по движениям и суммарный хранимый баланс счетов пользователей
+	rows, err := r.db.QueryContext(ctx, `SELECT a.code, COALESCE(SUM(e.amount), 0) FROM ledger_accounts a 
+	LEFT JOIN ledger_entries e ON e.account_id = a.id 
+	WHERE a.user_id IS NULL GROUP BY a.code 
+	UNION ALL 
+	SELECT 'user:*', COALESCE(SUM(balance), 0) FROM ledger_accounts WHERE user_id IS NOT NULL 
+	ORDER BY 1`)
+	if err != nil {
+		return nil, fmt.Errorf("GetTrialBalance: read accounts failed %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ab ledger.AccountBalance
+		if err := rows.Scan(&ab.Account, &ab.Balance); err != nil {
+			return nil, fmt.Errorf("GetTrialBalance: scan account row failed %w", err)
+		}
+		tb.Accounts = append(tb.Accounts, &ab)
+		// Сумма балансов всех счетов должна быть нулевой
+		tb.Total += ab.Balance
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetTrialBalance: accounts rows.Err %w", err)
+	}
+
+	// Проводки, сумма движений которых не равна нулю
+	postingRows, err := r.db.QueryContext(ctx, `SELECT posting_id FROM ledger_entries 
+	GROUP BY posting_id HAVING SUM(amount) <> 0 ORDER BY posting_id`)
+	if err != nil {
+		return nil, fmt.Errorf("GetTrialBalance: read unbalanced postings failed %w", err)
+	}
+	defer postingRows.Close()
+	for postingRows.Next() {
+		var id int
+		if err := postingRows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("GetTrialBalance: scan posting row failed %w", err)
+		}
+		tb.UnbalancedPostings = append(tb.UnbalancedPostings, id)
+	}
+	if err := postingRows.Err(); err != nil {
+		return nil, fmt.Errorf("GetTrialBalance: postings rows.Err %w", err)
+	}
+
+	// Счета пользователей, баланс которых не совпадает с движениями или с балансом пользователя
+	accountRows, err := r.db.QueryContext(ctx, `SELECT a.code FROM ledger_accounts a 
+	LEFT JOIN (SELECT account_id, SUM(amount) AS total FROM ledger_entries GROUP BY account_id) e 
+	ON e.account_id = a.id 
+	WHERE a.user_id IS NOT NULL AND a.balance <> COALESCE(e.total, 0) 
+	UNION 
+	SELECT COALESCE(a.code, 'user:' || ac.user_id) 
+	FROM (SELECT * FROM ledger_accounts WHERE code = 'user:' || user_id) a 
+	FULL JOIN accounts ac ON ac.user_id = a.user_id 
+	WHERE COALESCE(a.balance, 0) <> COALESCE(ac.current, 0) 
+	UNION 
+	SELECT COALESCE(a.code, 'user:' || ac.user_id || ':held') 
+	FROM (SELECT * FROM ledger_accounts WHERE code = 'user:' || user_id || ':held') a 
+	FULL JOIN accounts ac ON ac.user_id = a.user_id 
+	WHERE COALESCE(a.balance, 0) <> COALESCE(ac.held, 0) 
+	ORDER BY 1`)
+	if err != nil {
+		return nil, fmt.Errorf("GetTrialBalance: read mismatched accounts failed %w", err)
+	}
+	defer accountRows.Close()
+	for accountRows.Next() {
+		var code string
+		if err := accountRows.Scan(&code); err != nil {
+			return nil, fmt.Errorf("GetTrialBalance: scan account code failed %w", err)
+		}
+		tb.MismatchedAccounts = append(tb.MismatchedAccounts, code)
+	}
+	if err := accountRows.Err(); err != nil {
+		return nil, fmt.Errorf("GetTrialBalance: mismatched accounts rows.Err %w", err)
+	}
+
+	return &tb, nil
+}
@@ -0,0 +1,46 @@
+package ledger
+
+import (
+	"context"
+	"fmt"
+)
+
+type LedgerService struct {
+	repo Repository
+}
+
+func NewLedgerService(repo Repository) *LedgerService {
+	return &LedgerService{
+		repo: repo,
+	}
+}
+
+// Post проверяет сбалансированность проводки и записывает её в транзакции операции из контекста,
+// поэтому проводка подтверждается или откатывается вместе с операцией
+func (s *LedgerService) Post(ctx context.Context, p *Posting) error {
+	if err := p.Validate(); err != nil {
+		return fmt.Errorf("Post: %w", err)
+	}
+	if err := s.repo.Post(ctx, p); err != nil {
+		return fmt.Errorf("Post: post failed %w", err)
+	}
+	return nil
+}
+
+// AssignLegacyExpiry назначает срок истечения баллам, перенесённым из накопленных ранее
+func (s *LedgerService) AssignLegacyExpiry(ctx context.Context) error {
+	if err := s.repo.AssignLegacyExpiry(ctx); err != nil {
+		return fmt.Errorf("AssignLegacyExpiry: assign expiry failed %w", err)
+	}
+	return nil
+}
+
+// TrialBalance проверяет, что все проводки сбалансированы и балансы счетов совпадают с движениями
+func (s *LedgerService) TrialBalance(ctx context.Context) (*TrialBalance, error) {
+	tb, err := s.repo.GetTrialBalance(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("TrialBalance: get trial balance failed %w", err)
+	}
+	tb.Balanced = tb.Total == 0 && len(tb.UnbalancedPostings) == 0 && len(tb.MismatchedAccounts) == 0
+	return tb, nil
+}
@@ -6,14 +6,23 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/pavlegich/gophermart/internal/controllers/middlewares"
+	"github.com/pavlegich/gophermart/internal/domains/idempotency"
+	idempotencyRepo "github.com/pavlegich/gophermart/internal/domains/idempotency/repository"
+	"github.com/pavlegich/gophermart/internal/domains/ledger"
+	ledgerRepo "github.com/pavlegich/gophermart/internal/domains/ledger/repository"
 	"github.com/pavlegich/gophermart/internal/domains/order"
 	repo "github.com/pavlegich/gophermart/internal/domains/order/repository"
 	errs "github.com/pavlegich/gophermart/internal/errors"
+	"github.com/pavlegich/gophermart/internal/infra/accrual"
 	"github.com/pavlegich/gophermart/internal/infra/config"
 	"github.com/pavlegich/gophermart/internal/infra/logger"
 	"github.com/pavlegich/gophermart/internal/utils"
@@ -23,37 +32,59 @@ import (
 type OrderHandler struct {
 	Config  *config.Config
 	Service order.Service
-	Jobs    chan order.Order
+	Accrual accrual.Client
+	Limiter *accrual.Limiter
+	Breaker *accrual.Breaker
 }
 
 type responseOrder struct {
-	Number     string  `json:"number"`
-	Status     string  `json:"status"`
-	Accrual    float32 `json:"accrual,omitempty"`
-	UploadedAt string  `json:"uploaded_at"`
+	Number     string      `json:"number"`
+	Status     string      `json:"status"`
+	Accrual    utils.Money `json:"accrual,omitempty"`
+	UploadedAt string      `json:"uploaded_at"`
+}
+
+type responseStatusChange struct {
+	Status    string      `json:"status"`
+	Accrual   utils.Money `json:"accrual,omitempty"`
+	ChangedAt string      `json:"changed_at,omitempty"`
+}
+
+type responseOrderDetails struct {
+	responseOrder
+	History []responseStatusChange `json:"history"`
 }
 
 // Activate активирует обработчик запросов для заказов
-func Activate(ctx context.Context, r *chi.Mux, cfg *config.Config, db *sql.DB) {
-	s := order.NewOrderService(repo.NewOrderRepo(db))
-	newHandler(ctx, r, cfg, s)
+func Activate(ctx context.Context, public chi.Router, protected chi.Router, cfg *config.Config, db *sql.DB,
+	b *accrual.Breaker) {
+	ls := ledger.NewLedgerService(ledgerRepo.NewLedgerRepo(db, cfg.PointsExpiry))
+	s := order.NewOrderService(repo.NewOrderRepo(db), ls)
+	is := idempotency.NewIdempotencyService(idempotencyRepo.NewIdempotencyRepo(db), cfg.IdempotencyTTL, cfg.IdempotencyLease)
+	// Ограничитель запросов и автоматический выключатель общие для всех обработчиков заказов
+	l := accrual.NewLimiter(cfg.AccrualRPM)
+	ac := accrual.NewBreakerClient(accrual.NewLimitedClient(accrual.NewClient(cfg.Accrual), l), b)
+	newHandler(ctx, public, protected, cfg, s, is, ac, l, b)
 }
 
 // newHandler инициализирует обработчик запросов для заказов
-func newHandler(ctx context.Context, r *chi.Mux, cfg *config.Config, s order.Service) {
-	jobs := make(chan order.Order)
+func newHandler(ctx context.Context, public chi.Router, protected chi.Router, cfg *config.Config, s order.Service, is idempotency.Service,
+	ac accrual.Client, l *accrual.Limiter, b *accrual.Breaker) {
 	h := OrderHandler{
 		Config:  cfg,
 		Service: s,
-		Jobs:    jobs,
+		Accrual: ac,
+		Limiter: l,
+		Breaker: b,
 	}
-	r.Post("/api/user/orders", h.HandleOrdersUpload)
-	r.Get("/api/user/orders", h.HandleOrdersGet)
+	protected.With(middlewares.WithIdempotency(is)).Post("/api/user/orders", h.HandleOrdersUpload)
+	protected.With(middlewares.WithIdempotency(is)).Post("/api/user/orders/batch", h.HandleOrdersBatchUpload)
+	protected.Get("/api/user/orders", h.HandleOrdersGet)
+	protected.Get("/api/user/orders/{number}", h.HandleOrderGet)
 
 	for w := 1; w <= cfg.RateLimit; w++ {
-		go workerRequestAccrual(ctx, &h, h.Jobs)
+		go workerRequestAccrual(ctx, &h)
 	}
-	go workerCheckOrders(ctx, &h)
 }
 
 // HandleOrdersGet передаёт список заказов пользователя
@@ -68,6 +99,12 @@ func (h *OrderHandler) HandleOrdersGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Запрос с параметрами выборки обрабатывается постранично, без параметров возвращаются все заказы
+	if isPageRequest(r) {
+		h.handleOrdersPage(w, r, userID)
+		return
+	}
+
 	ordersList, err := h.Service.List(ctx, userID)
 	if err != nil {
 		if errors.Is(err, errs.ErrOrdersNotFound) {
@@ -106,6 +143,166 @@ func (h *OrderHandler) HandleOrdersGet(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(respJSON))
 }
 
+// HandleOrderGet передаёт заказ пользователя вместе с историей изменения его статуса
+func (h *OrderHandler) HandleOrderGet(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, err := utils.GetUserIDFromContext(ctx)
+	idString := strconv.Itoa(userID)
+	if err != nil {
+		logger.Log.With(zap.String("user_id", idString)).Error("HandleOrderGet: get user id from context failed")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	number := chi.URLParam(r, "number")
+	o, history, err := h.Service.Get(ctx, userID, number)
+	if err != nil {
+		if errors.Is(err, errs.ErrOrderNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		logger.Log.With(zap.String("user_id", idString)).Error("HandleOrderGet: get order failed",
+			zap.String("number", number),
+			zap.Error(err))
+		return
+	}
+
+	resp := responseOrderDetails{
+		responseOrder: responseOrder{
+			Number:     o.Number,
+			Status:     o.Status,
+			Accrual:    o.Accrual,
+			UploadedAt: o.CreatedAt.Format(time.RFC3339),
+		},
+		History: make([]responseStatusChange, 0, len(history)),
+	}
+	for _, c := range history {
+		change := responseStatusChange{
+			Status:  c.Status,
+			Accrual: c.Accrual,
+		}
+		if c.CreatedAt != nil {
+			change.ChangedAt = c.CreatedAt.Format(time.RFC3339)
+		}
+		resp.History = append(resp.History, change)
+	}
+
+	respJSON, err := json.Marshal(resp)
+	if err != nil {
+		logger.Log.With(zap.String("user_id", idString)).Error("HandleOrderGet: response marshal failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(respJSON))
+}
+
+// handleOrdersPage передаёт страницу заказов пользователя, ссылки на соседние страницы передаются в заголовке Link
+func (h *OrderHandler) handleOrdersPage(w http.ResponseWriter, r *http.Request, userID int) {
+	ctx := r.Context()
+	idString := strconv.Itoa(userID)
+
+	filter, err := parseListFilter(r)
+	if err != nil {
+		logger.Log.With(zap.String("user_id", idString)).Error("handleOrdersPage: parse filter failed",
+			zap.String("query", r.URL.RawQuery),
+			zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	ordersList, next, err := h.Service.ListPage(ctx, userID, filter)
+	if err != nil {
+		if errors.Is(err, errs.ErrIncorrectOrderFilter) {
+			w.WriteHeader(http.StatusBadRequest)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		logger.Log.With(zap.String("user_id", idString)).Error("handleOrdersPage: get orders page failed",
+			zap.Error(err))
+		return
+	}
+
+	links := make([]string, 0, 2)
+	if filter.Cursor != nil {
+		links = append(links, pageLink(r, "", "first"))
+	}
+	if next != nil {
+		links = append(links, pageLink(r, next.Encode(), "next"))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+
+	if len(ordersList) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	resp := make([]responseOrder, 0, len(ordersList))
+	for _, o := range ordersList {
+		resp = append(resp, responseOrder{
+			Number:     o.Number,
+			Status:     o.Status,
+			Accrual:    o.Accrual,
+			UploadedAt: o.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	respJSON, err := json.Marshal(resp)
+	if err != nil {
+		logger.Log.With(zap.String("user_id", idString)).Error("handleOrdersPage: response marshal failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(respJSON))
+}
+
+// isPageRequest проверяет, передан ли хотя бы один параметр постраничной выборки
+func isPageRequest(r *http.Request) bool {
+	q := r.URL.Query()
+	for _, key := range []string{"limit", "cursor", "status", "from", "to", "order"} {
+		if q.Has(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseListFilter разбирает параметры запроса списка заказов:
+// параметры постраничной выборки и status (через запятую)
+func parseListFilter(r *http.Request) (*order.ListFilter, error) {
+	q := r.URL.Query()
+	page, err := utils.ParsePage(q)
+	if err != nil {
+		return nil, fmt.Errorf("parseListFilter: %w", err)
+	}
+	return &order.ListFilter{
+		Statuses: utils.ParseListParam(q, "status"),
+		Page:     page,
+	}, nil
+}
+
+// pageLink возвращает ссылку на страницу с указанным курсором для заголовка Link
+func pageLink(r *http.Request, cursor string, rel string) string {
+	q := r.URL.Query()
+	q.Del("cursor")
+	if cursor != "" {
+		q.Set("cursor", cursor)
+	}
+	u := url.URL{Path: r.URL.Path, RawQuery: q.Encode()}
+	return "<" + u.String() + `>; rel="` + rel + `"`
+}
+
 // HandleOrdersUpload принимает и обрабатывает номер заказа
 func (h *OrderHandler) HandleOrdersUpload(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -146,13 +343,90 @@ func (h *OrderHandler) HandleOrdersUpload(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	h.Jobs <- order.Order{
-		ID:        req.ID,
-		Number:    req.Number,
-		UserID:    req.UserID,
-		Status:    req.Status,
-		CreatedAt: req.CreatedAt,
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// HandleOrdersBatchUpload принимает пакет номеров заказов в виде JSON-массива
+// или по одному номеру на строку и возвращает результат загрузки каждого номера
+func (h *OrderHandler) HandleOrdersBatchUpload(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var buf bytes.Buffer
+
+	userID, err := utils.GetUserIDFromContext(ctx)
+	idString := strconv.Itoa(userID)
+	if err != nil {
+		logger.Log.With(zap.String("user_id", idString)).Error("HandleOrdersBatchUpload: get user id from context failed")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 
-	w.WriteHeader(http.StatusAccepted)
+	if _, err := buf.ReadFrom(r.Body); err != nil {
+		logger.Log.With(zap.String("user_id", idString)).Error("HandleOrdersBatchUpload: read request body failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	numbers, err := parseBatchNumbers(r.Header.Get("Content-Type"), buf.Bytes())
+	if err != nil {
+		logger.Log.With(zap.String("user_id", idString)).Error("HandleOrdersBatchUpload: parse order numbers failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Принятые заказы ставятся в очередь опроса системы начисления баллов вместе с сохранением
+	items, err := h.Service.CreateBatch(ctx, userID, numbers)
+	if err != nil {
+		if errors.Is(err, errs.ErrIncorrectBatch) {
+			w.WriteHeader(http.StatusBadRequest)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		logger.Log.With(zap.String("user_id", idString)).Error("HandleOrdersBatchUpload: create orders batch failed",
+			zap.Error(err))
+		return
+	}
+
+	respJSON, err := json.Marshal(items)
+	if err != nil {
+		logger.Log.With(zap.String("user_id", idString)).Error("HandleOrdersBatchUpload: response marshal failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(respJSON))
+}
+
+// parseBatchNumbers разбирает тело запроса с пакетом номеров заказов:
+// JSON-массив строк или чисел, либо номера по одному на строку
+func parseBatchNumbers(contentType string, body []byte) ([]string, error) {
+	numbers := make([]string, 0)
+
+	if strings.HasPrefix(contentType, "application/json") {
+		var raw []json.RawMessage
+		if err := json.Unmarshal(body, &raw); err != nil {
+			return nil, fmt.Errorf("parseBatchNumbers: request unmarshal failed %w", err)
+		}
+		// Элемент, не являющийся строкой, передаётся как есть и не пройдёт проверку формата
+		for _, v := range raw {
+			var number string
+			if err := json.Unmarshal(v, &number); err != nil {
+				number = string(v)
+			}
+			numbers = append(numbers, strings.TrimSpace(number))
+		}
+		return numbers, nil
+	}
+
+	for _, line := range strings.Split(string(body), "\n") {
+		if number := strings.TrimSpace(line); number != "" {
+			numbers = append(numbers, number)
+		}
+	}
+	return numbers, nil
 }
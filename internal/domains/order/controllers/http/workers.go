@@ -1,164 +1,154 @@
 package http
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
-	"net/http"
-	"strconv"
 	"time"
 
 	"github.com/pavlegich/gophermart/internal/domains/order"
 	errs "github.com/pavlegich/gophermart/internal/errors"
+	"github.com/pavlegich/gophermart/internal/infra/accrual"
 	"github.com/pavlegich/gophermart/internal/infra/logger"
-	"github.com/pavlegich/gophermart/internal/utils"
 	"go.uber.org/zap"
 )
 
-type accrualResponseOrder struct {
-	Order   string  `json:"order"`
-	Status  string  `json:"status"`
-	Accrual float32 `json:"accrual,omitempty"`
-}
-
-// workerCheckOrders получает и отправляет в канал необработанные заказы
-func workerCheckOrders(ctx context.Context, h *OrderHandler) {
+// workerRequestAccrual захватывает задачи из очереди и опрашивает систему начисления баллов по заказам
+func workerRequestAccrual(ctx context.Context, h *OrderHandler) {
 	ticker := time.NewTicker(h.Config.Update)
+	defer ticker.Stop()
+
+	policy := &order.RetryPolicy{
+		Base:        h.Config.Update,
+		Max:         h.Config.JobBackoffMax,
+		MaxAttempts: h.Config.JobMaxAttempts,
+		MaxAge:      h.Config.JobMaxAge,
+	}
 
 	for {
+		if pollAccrual(ctx, h, policy) {
+			continue
+		}
+		// Ожидание появления новых задач или закрытия автоматического выключателя
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			// Получение списка заказов
-			ordersList, err := h.Service.ListUnprocessed(ctx)
-			if err != nil {
-				if !errors.Is(err, errs.ErrOrdersNotFound) {
-					logger.Log.Error("workerCheckOrders: get orders list failed",
-						zap.Error(err))
-				}
-				continue
-			}
-
-			// Отправка всех необработанных заказов в канал
-			for _, o := range ordersList {
-				job := order.Order{
-					ID:        o.ID,
-					Number:    o.Number,
-					UserID:    o.UserID,
-					Status:    o.Status,
-					Accrual:   o.Accrual,
-					CreatedAt: o.CreatedAt,
-				}
-				h.Jobs <- job
-			}
 		}
 	}
 }
 
-// workerRequestAccrual получает и обрабатывает ответ от системы начисления баллов по заказам
-func workerRequestAccrual(ctx context.Context, h *OrderHandler, jobs <-chan order.Order) {
-	timer := time.NewTimer(0)
+// pollAccrual захватывает одну задачу и опрашивает по ней систему начисления баллов;
+// возвращает false, если задач нет или обращаться к системе начисления сейчас нельзя
+func pollAccrual(ctx context.Context, h *OrderHandler, policy *order.RetryPolicy) bool {
+	// Пока автоматический выключатель открыт, задачи не захватываются; после таймаута задачу
+	// захватывает только обработчик, за которым закреплён пробный запрос
+	reservation, ok := h.Breaker.Reserve()
+	if !ok {
+		return false
+	}
+	// Проба, по которой запрос так и не был отправлен, снимается при любом выходе
+	defer h.Breaker.Release(reservation)
+	ctx = accrual.WithReservation(ctx, reservation)
 
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case ord, ok := <-jobs:
-			if !ok {
-				logger.Log.Error("workerRequestAccrual: channel is closed")
-				return
-			}
+	// Очередь на запрос выдерживается до захвата задачи, чтобы пауза по Retry-After
+	// или ограничение частоты запросов не расходовали аренду задачи
+	if err := h.Limiter.Wait(ctx); err != nil {
+		return false
+	}
 
-			orderNumber := ord.Number
-			if h.Config.Accrual == "" {
-				logger.Log.With(zap.String("order_id", orderNumber)).Error("workerRequestAccrual: accrual address is empty")
-				return
-			}
+	job, err := h.Service.ClaimJob(ctx, h.Config.JobLease)
+	if err != nil {
+		if !errors.Is(err, errs.ErrNoJobs) {
+			logger.Log.Error("pollAccrual: claim job failed",
+				zap.Error(err))
+		}
+		return false
+	}
 
-			reqURL := h.Config.Accrual + "/api/orders/" + orderNumber
-			req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
-			if err != nil {
-				logger.Log.With(zap.String("order_id", orderNumber)).Error("workerRequestAccrual: new request forming failed", zap.Error(err))
-				continue
-			}
+	orderNumber := job.Order.Number
+	res := processJob(ctx, h.Service, h.Accrual, job)
+	if res.done {
+		return true
+	}
 
-			// Запрос только в случае, если таймер остановлен
-			<-timer.C
-			resp, err := utils.GetRequestWithRetry(ctx, req)
-			if err != nil {
-				logger.Log.With(zap.String("order_id", orderNumber)).Error("workerRequestAccrual: request to accrual system failed",
-					zap.String("url", reqURL), zap.Error(err))
-				continue
-			}
-			defer resp.Body.Close()
-
-			// Обработка полученного статуса системы начисления баллов
-			if resp.StatusCode != http.StatusOK {
-				switch resp.StatusCode {
-				case http.StatusNoContent:
-					logger.Log.With(zap.String("order_id", orderNumber)).Error("workerRequestAccrual: order not found in accrual service")
-				case http.StatusTooManyRequests:
-					retryString := resp.Header.Get("Retry-After")
-					retry, err := strconv.Atoi(retryString)
-					if err != nil {
-						logger.Log.With(zap.String("order_id", orderNumber)).Error("workerRequestAccrual: retry header convert into integer failed",
-							zap.Error(err),
-							zap.String("Retry-After", retryString))
-					}
-					logger.Log.With(zap.String("order_id", orderNumber)).Error("workerRequestAccrual: status accrual too many requests",
-						zap.String("retry-after", retryString))
-					timer.Reset(time.Duration(retry) * time.Second)
-				case http.StatusInternalServerError:
-					logger.Log.With(zap.String("order_id", orderNumber)).Error("workerRequestAccrual: status internal accrual service error")
-				default:
-					logger.Log.With(zap.String("order_id", orderNumber)).Error("workerRequestAccrual: unexpected accrual service status code",
-						zap.Int("status", resp.StatusCode))
-				}
-				continue
-			}
+	// Задача возвращается в очередь с задержкой по числу попыток, но не раньше Retry-After,
+	// паузу запросов для всех обработчиков выдерживает общий ограничитель перед захватом задачи
+	if err := h.Service.RetryJob(ctx, job, policy, res.retryAfter, res.counted); err != nil {
+		if errors.Is(err, errs.ErrJobStale) {
+			logger.Log.With(zap.String("order_id", orderNumber)).Warn("pollAccrual: order polling stopped",
+				zap.Int("attempts", job.Attempts))
+		} else if errors.Is(err, errs.ErrJobLeaseLost) {
+			logger.Log.With(zap.String("order_id", orderNumber)).Warn("pollAccrual: job lease lost")
+		} else {
+			logger.Log.With(zap.String("order_id", orderNumber)).Error("pollAccrual: retry job failed",
+				zap.Error(err))
+		}
+	}
+	return true
+}
 
-			// Обработка тела ответа системы начисления баллов
-			var buf bytes.Buffer
-			var respJSON accrualResponseOrder
-			if _, err := buf.ReadFrom(resp.Body); err != nil {
-				logger.Log.With(zap.String("order_id", orderNumber)).Error("workerRequestAccrual: read response body failed",
-					zap.Error(err))
-				continue
-			}
-			if err := json.Unmarshal(buf.Bytes(), &respJSON); err != nil {
-				logger.Log.With(zap.String("order_id", orderNumber)).Error("workerRequestAccrual: response unmarshal failed",
-					zap.String("body", buf.String()),
-					zap.Error(err))
-				continue
-			}
+// jobResult хранит итог попытки опроса: завершена ли задача, расходует ли попытка лимит попыток
+// и время, на которое система начисления баллов ограничила запросы
+type jobResult struct {
+	done       bool
+	counted    bool
+	retryAfter time.Duration
+}
 
-			// Проверка статуса обработки заказа в системе начисления баллов
-			if resp.StatusCode == http.StatusOK {
-				switch respJSON.Status {
-				case "REGISTERED":
-					continue
-				case "INVALID":
-					ord.Status = respJSON.Status
-					ord.Accrual = 0
-				case "PROCESSING":
-					ord.Status = respJSON.Status
-				case "PROCESSED":
-					ord.Status = respJSON.Status
-					ord.Accrual = respJSON.Accrual
-				default:
-					logger.Log.With(zap.String("order_id", orderNumber)).Error("workerRequestAccrual: invalid response order status",
-						zap.String("status", respJSON.Status))
-					continue
-				}
-			}
+// processJob запрашивает статус заказа в системе начисления баллов и сохраняет его
+func processJob(ctx context.Context, s order.Service, ac accrual.Client, job *order.Job) jobResult {
+	ord := job.Order
+	orderNumber := ord.Number
 
-			// Загрузка обновленного заказа в хранилище
-			if err := h.Service.Upload(ctx, &ord); err != nil {
-				logger.Log.With(zap.String("order_id", orderNumber)).Error("workerRequestAccrual: upload order failed",
+	res, err := ac.GetOrder(ctx, orderNumber)
+	if err != nil {
+		var rateErr *accrual.RateLimitError
+		switch {
+		case errors.As(err, &rateErr):
+			logger.Log.With(zap.String("order_id", orderNumber)).Error("processJob: status accrual too many requests",
+				zap.Duration("retry-after", rateErr.RetryAfter))
+			return jobResult{retryAfter: rateErr.RetryAfter}
+		case errors.Is(err, errs.ErrAccrualUnavailable):
+			logger.Log.With(zap.String("order_id", orderNumber)).Debug("processJob: accrual system unavailable")
+		case errors.Is(err, errs.ErrAccrualNotRegistered):
+			logger.Log.With(zap.String("order_id", orderNumber)).Error("processJob: order not found in accrual service")
+			return jobResult{counted: true}
+		default:
+			logger.Log.With(zap.String("order_id", orderNumber)).Error("processJob: get order from accrual system failed",
+				zap.Error(err))
+		}
+		return jobResult{}
+	}
+
+	// Проверка статуса обработки заказа в системе начисления баллов
+	switch res.Status {
+	case accrual.StatusRegistered:
+		return jobResult{counted: true}
+	case accrual.StatusInvalid:
+		ord.Status = order.StatusInvalid
+		ord.Accrual = 0
+	case accrual.StatusProcessing:
+		ord.Status = order.StatusProcessing
+	case accrual.StatusProcessed:
+		ord.Status = order.StatusProcessed
+		ord.Accrual = res.Accrual
+	}
+
+	// Загрузка обновленного заказа в хранилище, задача заказа в итоговом статусе удаляется вместе с обновлением
+	if err := s.Upload(ctx, &ord); err != nil {
+		logger.Log.With(zap.String("order_id", orderNumber)).Error("processJob: upload order failed",
+			zap.Error(err))
+		if errors.Is(err, errs.ErrOrderAlreadyProcessed) {
+			if err := s.CompleteJob(ctx, job); err != nil {
+				logger.Log.With(zap.String("order_id", orderNumber)).Error("processJob: complete job failed",
 					zap.Error(err))
 			}
+			return jobResult{done: true}
 		}
+		return jobResult{}
 	}
+
+	// Заказ, который система начисления ещё обрабатывает, опрашивается с нарастающей задержкой
+	done := ord.Status == order.StatusProcessed || ord.Status == order.StatusInvalid
+	return jobResult{done: done, counted: !done}
 }
@@ -0,0 +1,155 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pavlegich/gophermart/internal/domains/order"
+	errs "github.com/pavlegich/gophermart/internal/errors"
+	"github.com/pavlegich/gophermart/internal/infra/accrual"
+	"github.com/pavlegich/gophermart/internal/infra/config"
+)
+
+// fakeAccrual возвращает заданный ответ системы начисления баллов
+type fakeAccrual struct {
+	res *accrual.Result
+	err error
+}
+
+func (f *fakeAccrual) GetOrder(ctx context.Context, number string) (*accrual.Result, error) {
+	return f.res, f.err
+}
+
+// fakeService запоминает загруженные заказы и завершённые задачи
+type fakeService struct {
+	order.Service
+	uploadErr error
+	uploaded  []order.Order
+	completed []int
+}
+
+func (f *fakeService) Upload(ctx context.Context, ord *order.Order) error {
+	f.uploaded = append(f.uploaded, *ord)
+	return f.uploadErr
+}
+
+func (f *fakeService) CompleteJob(ctx context.Context, job *order.Job) error {
+	f.completed = append(f.completed, job.ID)
+	return nil
+}
+
+func TestProcessJob(t *testing.T) {
+	tests := []struct {
+		name          string
+		accrual       *fakeAccrual
+		uploadErr     error
+		want          jobResult
+		wantUploaded  string
+		wantAccrual   int64
+		wantCompleted bool
+	}{
+		{
+			name:    "not_registered",
+			accrual: &fakeAccrual{err: fmt.Errorf("GetOrder: %w", errs.ErrAccrualNotRegistered)},
+			want:    jobResult{counted: true},
+		},
+		{
+			name:    "registered",
+			accrual: &fakeAccrual{res: &accrual.Result{Order: "79927398713", Status: accrual.StatusRegistered}},
+			want:    jobResult{counted: true},
+		},
+		{
+			name:    "rate_limited",
+			accrual: &fakeAccrual{err: fmt.Errorf("GetOrder: %w", &accrual.RateLimitError{RetryAfter: 42 * time.Second})},
+			want:    jobResult{retryAfter: 42 * time.Second},
+		},
+		{
+			name:    "unavailable",
+			accrual: &fakeAccrual{err: fmt.Errorf("GetOrder: %w", errs.ErrAccrualUnavailable)},
+			want:    jobResult{},
+		},
+		{
+			name:         "processing",
+			accrual:      &fakeAccrual{res: &accrual.Result{Order: "79927398713", Status: accrual.StatusProcessing}},
+			want:         jobResult{counted: true},
+			wantUploaded: order.StatusProcessing,
+		},
+		{
+			name: "processed",
+			accrual: &fakeAccrual{res: &accrual.Result{Order: "79927398713", Status: accrual.StatusProcessed,
+				Accrual: 50012}},
+			want:         jobResult{done: true},
+			wantUploaded: order.StatusProcessed,
+			wantAccrual:  50012,
+		},
+		{
+			name:         "invalid",
+			accrual:      &fakeAccrual{res: &accrual.Result{Order: "79927398713", Status: accrual.StatusInvalid}},
+			want:         jobResult{done: true},
+			wantUploaded: order.StatusInvalid,
+		},
+		{
+			name: "already_processed",
+			accrual: &fakeAccrual{res: &accrual.Result{Order: "79927398713", Status: accrual.StatusProcessed,
+				Accrual: 100}},
+			uploadErr:     fmt.Errorf("Upload: %w", errs.ErrOrderAlreadyProcessed),
+			want:          jobResult{done: true},
+			wantUploaded:  order.StatusProcessed,
+			wantAccrual:   100,
+			wantCompleted: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &fakeService{uploadErr: tt.uploadErr}
+			job := &order.Job{
+				ID:    3,
+				Order: order.Order{ID: 1, Number: "79927398713", UserID: 7, Status: order.StatusNew},
+			}
+
+			got := processJob(context.Background(), s, tt.accrual, job)
+			if got != tt.want {
+				t.Fatalf("expected %+v, got %+v", tt.want, got)
+			}
+
+			if tt.wantUploaded == "" {
+				if len(s.uploaded) != 0 {
+					t.Fatalf("expected no upload, got %+v", s.uploaded)
+				}
+			} else {
+				if len(s.uploaded) != 1 || s.uploaded[0].Status != tt.wantUploaded ||
+					int64(s.uploaded[0].Accrual) != tt.wantAccrual {
+					t.Fatalf("expected upload with status %s and accrual %d, got %+v",
+						tt.wantUploaded, tt.wantAccrual, s.uploaded)
+				}
+			}
+
+			if completed := len(s.completed) == 1 && s.completed[0] == job.ID; completed != tt.wantCompleted {
+				t.Fatalf("expected job completed %v, got %v", tt.wantCompleted, s.completed)
+			}
+		})
+	}
+}
+
+func TestPollAccrualReleasesProbeWhenLimiterStops(t *testing.T) {
+	b := accrual.NewBreaker(1, 10*time.Millisecond)
+	b.Failure()
+	time.Sleep(20 * time.Millisecond)
+
+	l := accrual.NewLimiter(0)
+	l.Pause(time.Hour)
+	h := &OrderHandler{Config: &config.Config{}, Service: &fakeService{}, Limiter: l, Breaker: b}
+
+	// Обработчик останавливается, пока ждёт очереди на запрос
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if pollAccrual(ctx, h, &order.RetryPolicy{}) {
+		t.Fatalf("expected poll to stop without a job")
+	}
+
+	if _, ok := b.Reserve(); !ok {
+		t.Fatalf("expected probe to be released after limiter wait failed")
+	}
+}
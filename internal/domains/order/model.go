@@ -2,28 +2,141 @@ package order
 
 import (
 	"context"
+	"math"
 	"time"
+
+	"github.com/pavlegich/gophermart/internal/utils"
+)
+
+// Статусы обработки заказа
+const (
+	StatusNew        = "NEW"
+	StatusProcessing = "PROCESSING"
+	StatusInvalid    = "INVALID"
+	StatusProcessed  = "PROCESSED"
+)
+
+// Ограничения размера страницы списка заказов
+const (
+	ListDefaultLimit = 50
+	ListMaxLimit     = 500
+)
+
+// Результаты загрузки заказа в пакете
+const (
+	BatchAccepted          = "accepted"
+	BatchAlreadyUploaded   = "already_uploaded"
+	BatchUploadedByAnother = "uploaded_by_another"
+	BatchInvalidFormat     = "invalid_format"
 )
 
+// BatchMaxSize максимальное количество номеров заказов в пакете
+const BatchMaxSize = 1000
+
+// BatchItem хранит результат загрузки одного номера заказа из пакета
+type BatchItem struct {
+	Number string `json:"number"`
+	Result string `json:"result"`
+}
+
+// ListFilter хранит условия постраничной выборки заказов
+type ListFilter struct {
+	Statuses []string
+	utils.Page
+}
+
 type Order struct {
-	ID        int       `json:"id"`
-	Number    string    `json:"number"`
-	UserID    int       `json:"user_id,omitempty"`
-	Status    string    `json:"status,omitempty"`
-	Accrual   float32   `json:"accrual,omitempty"`
-	CreatedAt time.Time `json:"created_at,omitempty"`
+	ID        int         `json:"id"`
+	Number    string      `json:"number"`
+	UserID    int         `json:"user_id,omitempty"`
+	Status    string      `json:"status,omitempty"`
+	Accrual   utils.Money `json:"accrual,omitempty"`
+	CreatedAt time.Time   `json:"created_at,omitempty"`
+}
+
+// Статусы задачи опроса системы начисления баллов
+const (
+	JobPending = "PENDING"
+	JobStale   = "STALE"
+)
+
+// Job хранит задачу опроса системы начисления баллов по заказу
+type Job struct {
+	ID          int
+	Order       Order
+	Status      string
+	Attempts    int
+	LockedUntil time.Time
+	StaleAt     time.Time
+	CreatedAt   time.Time
+}
+
+// RetryPolicy задаёт экспоненциальную задержку между попытками опроса
+// и условия перевода задачи в статус STALE
+type RetryPolicy struct {
+	Base        time.Duration
+	Max         time.Duration
+	MaxAttempts int
+	MaxAge      time.Duration
+}
+
+// Delay возвращает задержку перед следующей попыткой после указанного количества попыток,
+// нулевая максимальная задержка снимает ограничение
+func (p *RetryPolicy) Delay(attempts int) time.Duration {
+	delay := p.Base
+	for i := 1; i < attempts && (p.Max <= 0 || delay < p.Max) && delay <= math.MaxInt64/2; i++ {
+		delay *= 2
+	}
+	if p.Max > 0 && delay > p.Max {
+		delay = p.Max
+	}
+	return delay
+}
+
+// Exhausted проверяет, исчерпаны ли попытки опроса по задаче
+func (p *RetryPolicy) Exhausted(job *Job) bool {
+	return p.MaxAttempts > 0 && job.Attempts >= p.MaxAttempts
+}
+
+// Expired проверяет, превышен ли срок опроса по задаче
+func (p *RetryPolicy) Expired(job *Job) bool {
+	return p.MaxAge > 0 && time.Since(job.CreatedAt) >= p.MaxAge
+}
+
+// StatusChange хранит переход заказа в новый статус, время перехода неизвестно для перенесённых записей
+type StatusChange struct {
+	Status    string      `json:"status"`
+	Accrual   utils.Money `json:"accrual,omitempty"`
+	CreatedAt *time.Time  `json:"changed_at,omitempty"`
 }
 
 type Service interface {
 	Create(ctx context.Context, order *Order) error
+	CreateBatch(ctx context.Context, userID int, numbers []string) ([]*BatchItem, error)
 	List(ctx context.Context, userID int) ([]*Order, error)
+	ListPage(ctx context.Context, userID int, filter *ListFilter) ([]*Order, *utils.Cursor, error)
+	Get(ctx context.Context, userID int, number string) (*Order, []*StatusChange, error)
 	Upload(ctx context.Context, order *Order) error
-	ListUnprocessed(ctx context.Context) ([]*Order, error)
+	ClaimJob(ctx context.Context, lease time.Duration) (*Job, error)
+	RetryJob(ctx context.Context, job *Job, policy *RetryPolicy, minDelay time.Duration, counted bool) error
+	CompleteJob(ctx context.Context, job *Job) error
+	ListStaleJobs(ctx context.Context) ([]*Job, error)
+	RequeueJob(ctx context.Context, number string) error
 }
 
 type Repository interface {
 	CreateOrder(ctx context.Context, order *Order) error
+	CreateOrders(ctx context.Context, orders []*Order) ([]error, error)
 	GetAllOrders(ctx context.Context, userID int) ([]*Order, error)
-	UpdateOrder(ctx context.Context, order *Order) error
-	GetUnprocessedOrders(ctx context.Context) ([]*Order, error)
+	GetOrdersPage(ctx context.Context, userID int, filter *ListFilter) ([]*Order, error)
+	GetOrder(ctx context.Context, userID int, number string) (*Order, error)
+	GetStatusHistory(ctx context.Context, orderID int) ([]*StatusChange, error)
+	UpdateOrder(ctx context.Context, order *Order, post func(ctx context.Context, balanceID int) error) error
+	ClaimJob(ctx context.Context, lease time.Duration) (*Job, error)
+	RetryJob(ctx context.Context, job *Job, delay time.Duration) error
+	DeleteJob(ctx context.Context, job *Job) error
+	MarkJobStale(ctx context.Context, job *Job) error
+	GetStaleJobs(ctx context.Context) ([]*Job, error)
+	RequeueJob(ctx context.Context, number string) error
+	ResetOrder(ctx context.Context, number string) error
 }
@@ -0,0 +1,29 @@
+package order
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		max      time.Duration
+		attempts int
+		want     time.Duration
+	}{
+		{name: "first", max: time.Hour, attempts: 1, want: time.Second},
+		{name: "doubled", max: time.Hour, attempts: 4, want: 8 * time.Second},
+		{name: "capped", max: 10 * time.Second, attempts: 10, want: 10 * time.Second},
+		{name: "no_cap", max: 0, attempts: 10, want: 512 * time.Second},
+		{name: "no_overflow", max: 0, attempts: 100, want: time.Second << 33},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := RetryPolicy{Base: time.Second, Max: tt.max}
+			if got := p.Delay(tt.attempts); got != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pavlegich/gophermart/internal/domains/order"
+	errs "github.com/pavlegich/gophermart/internal/errors"
+)
+
+// ClaimJob захватывает готовую к выполнению задачу опроса системы начисления баллов на время аренды,
+// задачи, захваченные другими обработчиками, пропускаются
+func (r *Repository) ClaimJob(ctx context.Context, lease time.Duration) (*order.Job, error) {
+	// Проверка базы данных
+	if err := r.db.PingContext(ctx); err != nil {
+		return nil, fmt.Errorf("ClaimJob: connection to database in died %w", err)
+	}
+
+	// Задача с истёкшей арендой считается освобождённой
+	var job order.Job
+	row := r.db.QueryRowContext(ctx, `WITH claimed AS (
+		UPDATE accrual_jobs SET locked_until = NOW() + make_interval(secs => $1), 
+		updated_at = NOW() 
+		WHERE id = (SELECT id FROM accrual_jobs 
+			WHERE status = 'PENDING' AND next_attempt_at <= NOW() 
+			AND (locked_until IS NULL OR locked_until <= NOW()) 
+			ORDER BY next_attempt_at LIMIT 1 FOR UPDATE SKIP LOCKED) 
+		RETURNING id, order_id, status, attempts, locked_until, created_at
+	)
+	SELECT c.id, c.status, c.attempts, c.locked_until, c.created_at, o.id, o.number, o.user_id, o.status, o.accrual, o.created_at 
+	FROM claimed c JOIN orders o ON o.id = c.order_id`, lease.Seconds())
+	if err := row.Scan(&job.ID, &job.Status, &job.Attempts, &job.LockedUntil, &job.CreatedAt, &job.Order.ID, &job.Order.Number,
+		&job.Order.UserID, &job.Order.Status, &job.Order.Accrual, &job.Order.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("ClaimJob: %w", errs.ErrNoJobs)
+		}
+		return nil, fmt.Errorf("ClaimJob: scan job row failed %w", err)
+	}
+
+	return &job, nil
+}
+
+// RetryJob освобождает задачу, сохраняет счётчик попыток и откладывает следующую попытку на указанное время
+func (r *Repository) RetryJob(ctx context.Context, job *order.Job, delay time.Duration) error {
+	// Проверка базы данных
+	if err := r.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("RetryJob: connection to database in died %w", err)
+	}
+
+	res, err := r.db.ExecContext(ctx, `UPDATE accrual_jobs SET attempts = $1, locked_until = NULL, 
+	next_attempt_at = NOW() + make_interval(secs => $2), updated_at = NOW() 
+	WHERE id = $3 AND locked_until = $4`, job.Attempts, delay.Seconds(), job.ID, job.LockedUntil)
+	if err != nil {
+		return fmt.Errorf("RetryJob: update table failed %w", err)
+	}
+	if err := checkLease(res); err != nil {
+		return fmt.Errorf("RetryJob: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteJob удаляет выполненную задачу из очереди
+func (r *Repository) DeleteJob(ctx context.Context, job *order.Job) error {
+	// Проверка базы данных
+	if err := r.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("DeleteJob: connection to database in died %w", err)
+	}
+
+	res, err := r.db.ExecContext(ctx, `DELETE FROM accrual_jobs WHERE id = $1 AND locked_until = $2`,
+		job.ID, job.LockedUntil)
+	if err != nil {
+		return fmt.Errorf("DeleteJob: delete from table failed %w", err)
+	}
+	if err := checkLease(res); err != nil {
+		return fmt.Errorf("DeleteJob: %w", err)
+	}
+
+	return nil
+}
+
+// MarkJobStale останавливает опрос по задаче, переводя её в статус STALE
+func (r *Repository) MarkJobStale(ctx context.Context, job *order.Job) error {
+	// Проверка базы данных
+	if err := r.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("MarkJobStale: connection to database in died %w", err)
+	}
+
+	res, err := r.db.ExecContext(ctx, `UPDATE accrual_jobs SET status = 'STALE', attempts = $1, stale_at = NOW(), 
+	locked_until = NULL, updated_at = NOW() WHERE id = $2 AND locked_until = $3`,
+		job.Attempts, job.ID, job.LockedUntil)
+	if err != nil {
+		return fmt.Errorf("MarkJobStale: update table failed %w", err)
+	}
+	if err := checkLease(res); err != nil {
+		return fmt.Errorf("MarkJobStale: %w", err)
+	}
+
+	return nil
+}
+
+// checkLease проверяет, что задача изменена владельцем аренды: если аренда истекла и задачу
+// захватил другой обработчик, срок аренды в строке уже другой и запрос не затрагивает ни одной строки
+func checkLease(res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("checkLease: get affected rows failed %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("checkLease: %w", errs.ErrJobLeaseLost)
+	}
+	return nil
+}
+
+// GetStaleJobs возвращает остановленные задачи вместе с заказами, начиная с последних
+func (r *Repository) GetStaleJobs(ctx context.Context) ([]*order.Job, error) {
+	// Проверка базы данных
+	if err := r.db.PingContext(ctx); err != nil {
+		return nil, fmt.Errorf("GetStaleJobs: connection to database in died %w", err)
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT j.id, j.status, j.attempts, j.stale_at, j.created_at, 
+	o.id, o.number, o.user_id, o.status, o.accrual, o.created_at 
+	FROM accrual_jobs j JOIN orders o ON o.id = j.order_id 
+	WHERE j.status = 'STALE' ORDER BY j.stale_at DESC, j.id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("GetStaleJobs: read rows from table failed %w", err)
+	}
+	defer rows.Close()
+
+	jobs := make([]*order.Job, 0)
+	for rows.Next() {
+		var job order.Job
+		if err := rows.Scan(&job.ID, &job.Status, &job.Attempts, &job.StaleAt, &job.CreatedAt, &job.Order.ID,
+			&job.Order.Number, &job.Order.UserID, &job.Order.Status, &job.Order.Accrual, &job.Order.CreatedAt); err != nil {
+			return nil, fmt.Errorf("GetStaleJobs: scan row failed %w", err)
+		}
+		jobs = append(jobs, &job)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("GetStaleJobs: rows.Err %w", err)
+	}
+
+	return jobs, nil
+}
+
+// RequeueJob возвращает остановленную задачу заказа в очередь со сброшенным счётчиком попыток
+func (r *Repository) RequeueJob(ctx context.Context, number string) error {
+	// Проверка базы данных
+	if err := r.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("RequeueJob: connection to database in died %w", err)
+	}
+
+	res, err := r.db.ExecContext(ctx, `UPDATE accrual_jobs j SET status = 'PENDING', attempts = 0, 
+	next_attempt_at = NOW(), locked_until = NULL, stale_at = NULL, created_at = NOW(), updated_at = NOW() 
+	FROM orders o WHERE o.id = j.order_id AND o.number = $1 AND j.status = 'STALE'`, number)
+	if err != nil {
+		return fmt.Errorf("RequeueJob: update table failed %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("RequeueJob: get affected rows failed %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("RequeueJob: %w", errs.ErrStaleJobNotFound)
+	}
+
+	return nil
+}
+
+// enqueueJob ставит заказ в очередь опроса системы начисления баллов в рамках транзакции,
+// существующая задача заказа сбрасывается
+func enqueueJob(ctx context.Context, tx *sql.Tx, orderID int) error {
+	if _, err := tx.ExecContext(ctx, `INSERT INTO accrual_jobs (order_id) VALUES ($1) 
+	ON CONFLICT (order_id) DO UPDATE SET status = 'PENDING', attempts = 0, next_attempt_at = NOW(), 
+	locked_until = NULL, stale_at = NULL, created_at = NOW(), updated_at = NOW()`, orderID); err != nil {
+		return fmt.Errorf("enqueueJob: insert into accrual_jobs failed %w", err)
+	}
+	return nil
+}
+
+// deleteOrderJob удаляет задачу заказа из очереди в рамках транзакции
+func deleteOrderJob(ctx context.Context, tx *sql.Tx, orderID int) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM accrual_jobs WHERE order_id = $1`, orderID); err != nil {
+		return fmt.Errorf("deleteOrderJob: delete from accrual_jobs failed %w", err)
+	}
+	return nil
+}
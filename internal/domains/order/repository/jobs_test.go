@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pavlegich/gophermart/internal/domains/order"
+	errs "github.com/pavlegich/gophermart/internal/errors"
+)
+
+func TestJobLeaseLost(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("create sqlmock failed %v", err)
+	}
+	defer db.Close()
+
+	r := NewOrderRepo(db)
+	ctx := context.Background()
+	job := &order.Job{ID: 5, LockedUntil: time.Now()}
+
+	// Аренда истекла, задачу захватил другой обработчик: строки с выданным сроком аренды нет
+	mock.ExpectExec(regexp.QuoteMeta(`WHERE id = $3 AND locked_until = $4`)).
+		WithArgs(job.Attempts, sqlmock.AnyArg(), job.ID, job.LockedUntil).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := r.RetryJob(ctx, job, time.Second); !errors.Is(err, errs.ErrJobLeaseLost) {
+		t.Fatalf("retry: expected lease lost, got %v", err)
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM accrual_jobs WHERE id = $1 AND locked_until = $2`)).
+		WithArgs(job.ID, job.LockedUntil).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := r.DeleteJob(ctx, job); !errors.Is(err, errs.ErrJobLeaseLost) {
+		t.Fatalf("delete: expected lease lost, got %v", err)
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(`WHERE id = $2 AND locked_until = $3`)).
+		WithArgs(job.Attempts, job.ID, job.LockedUntil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := r.MarkJobStale(ctx, job); err != nil {
+		t.Fatalf("stale: unexpected error %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations %v", err)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/pavlegich/gophermart/internal/domains/order"
 	errs "github.com/pavlegich/gophermart/internal/errors"
+	"github.com/pavlegich/gophermart/internal/utils"
 )
 
 type Repository struct {
@@ -54,6 +55,44 @@ func (r *Repository) GetAllOrders(ctx context.Context, userID int) ([]*order.Ord
 	return storedOrders, nil
 }
 
+// GetOrdersPage возвращает заказы пользователя с учётом фильтров, порядка и курсора
+func (r *Repository) GetOrdersPage(ctx context.Context, userID int, f *order.ListFilter) ([]*order.Order, error) {
+	// Проверка базы данных
+	if err := r.db.PingContext(ctx); err != nil {
+		return nil, fmt.Errorf("GetOrdersPage: connection to database in died %w", err)
+	}
+
+	// Сборка условий запроса
+	var q utils.PageQuery
+	q.Where("user_id = " + q.Arg(userID))
+	if len(f.Statuses) > 0 {
+		q.Where("status::text = ANY(" + q.Arg(f.Statuses) + "::text[])")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT id, number, user_id, status, accrual, created_at 
+	FROM orders WHERE `+q.Page(&f.Page), q.Args...)
+	if err != nil {
+		return nil, fmt.Errorf("GetOrdersPage: read rows from table failed %w", err)
+	}
+	defer rows.Close()
+
+	storedOrders := make([]*order.Order, 0)
+	for rows.Next() {
+		var ord order.Order
+		if err := rows.Scan(&ord.ID, &ord.Number, &ord.UserID, &ord.Status, &ord.Accrual, &ord.CreatedAt); err != nil {
+			return nil, fmt.Errorf("GetOrdersPage: scan row failed %w", err)
+		}
+		storedOrders = append(storedOrders, &ord)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("GetOrdersPage: rows.Err %w", err)
+	}
+
+	return storedOrders, nil
+}
+
 // CreateOrder сохраняет данные нового заказа в хранилище
 func (r *Repository) CreateOrder(ctx context.Context, ord *order.Order) error {
 	// Проверка базы данных
@@ -95,6 +134,13 @@ func (r *Repository) CreateOrder(ctx context.Context, ord *order.Order) error {
 	ord.Status = storedOrder.Status
 	ord.CreatedAt = storedOrder.CreatedAt
 
+	if err := insertStatusChange(ctx, tx, ord.ID, ord.Status, 0); err != nil {
+		return fmt.Errorf("CreateOrder: %w", err)
+	}
+	if err := enqueueJob(ctx, tx, ord.ID); err != nil {
+		return fmt.Errorf("CreateOrder: %w", err)
+	}
+
 	// Подтверждение транзакции
 	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("CreateOrder: commit transaction failed %w", err)
@@ -103,8 +149,70 @@ func (r *Repository) CreateOrder(ctx context.Context, ord *order.Order) error {
 	return nil
 }
 
-// UpdateOrder обновляет данные о заказе и создаёт запись о начислении за обработанный заказ
-func (r *Repository) UpdateOrder(ctx context.Context, ord *order.Order) error {
+// CreateOrders сохраняет пакет новых заказов в одной транзакции,
+// возвращает ошибку по каждому заказу, если он уже был загружен
+func (r *Repository) CreateOrders(ctx context.Context, orders []*order.Order) ([]error, error) {
+	// Проверка базы данных
+	if err := r.db.PingContext(ctx); err != nil {
+		return nil, fmt.Errorf("CreateOrders: connection to database in died %w", err)
+	}
+
+	// Начало транзакции
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("CreateOrders: begin transaction failed %w", err)
+	}
+	defer tx.Rollback()
+
+	insertStmt, err := tx.PrepareContext(ctx, `INSERT INTO orders (number, user_id) VALUES ($1, $2) 
+	ON CONFLICT (number) DO NOTHING RETURNING id, status, created_at`)
+	if err != nil {
+		return nil, fmt.Errorf("CreateOrders: prepare insert statement failed %w", err)
+	}
+	defer insertStmt.Close()
+
+	results := make([]error, len(orders))
+	for i, ord := range orders {
+		row := insertStmt.QueryRowContext(ctx, ord.Number, ord.UserID)
+		err := row.Scan(&ord.ID, &ord.Status, &ord.CreatedAt)
+		if err == nil {
+			if err := insertStatusChange(ctx, tx, ord.ID, ord.Status, 0); err != nil {
+				return nil, fmt.Errorf("CreateOrders: %w", err)
+			}
+			if err := enqueueJob(ctx, tx, ord.ID); err != nil {
+				return nil, fmt.Errorf("CreateOrders: %w", err)
+			}
+			continue
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("CreateOrders: insert into table failed %w", err)
+		}
+
+		// Заказ с таким номером уже существует, определяется его владелец
+		var userID int
+		if err := tx.QueryRowContext(ctx, `SELECT user_id FROM orders WHERE number = $1`,
+			ord.Number).Scan(&userID); err != nil {
+			return nil, fmt.Errorf("CreateOrders: scan order row with user id failed %w", err)
+		}
+		if userID == ord.UserID {
+			results[i] = errs.ErrOrderAlreadyUpload
+		} else {
+			results[i] = errs.ErrOrderUploadByAnother
+		}
+	}
+
+	// Подтверждение транзакции
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("CreateOrders: commit transaction failed %w", err)
+	}
+
+	return results, nil
+}
+
+// UpdateOrder обновляет данные о заказе и создаёт запись о начислении за обработанный заказ,
+// проводка начисления записывается через post
+func (r *Repository) UpdateOrder(ctx context.Context, ord *order.Order,
+	post func(ctx context.Context, balanceID int) error) error {
 	// Проверка базы данных
 	if err := r.db.PingContext(ctx); err != nil {
 		return fmt.Errorf("UpdateOrder: connection to database in died %w", err)
@@ -117,24 +225,64 @@ func (r *Repository) UpdateOrder(ctx context.Context, ord *order.Order) error {
 	}
 	defer tx.Rollback()
 
+	// Блокировка заказа и проверка текущего статуса, обработанный заказ не изменяется
+	var prevStatus string
+	row := tx.QueryRowContext(ctx, `SELECT status FROM orders WHERE id = $1 FOR UPDATE`, ord.ID)
+	if err := row.Scan(&prevStatus); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("UpdateOrder: %w", errs.ErrOrderNotFound)
+		}
+		return fmt.Errorf("UpdateOrder: scan order row failed %w", err)
+	}
+	if prevStatus == order.StatusProcessed || prevStatus == order.StatusInvalid {
+		return fmt.Errorf("UpdateOrder: %w", errs.ErrOrderAlreadyProcessed)
+	}
+
 	// Выполнение запроса к базе данных
-	if _, err := tx.ExecContext(ctx, `UPDATE orders SET status = $1, accrual = $2 
-	WHERE id = $3 AND status NOT IN ('PROCESSED', 'INVALID')`,
+	if _, err := tx.ExecContext(ctx, `UPDATE orders SET status = $1, accrual = $2 WHERE id = $3`,
 		ord.Status, ord.Accrual, ord.ID); err != nil {
 		return fmt.Errorf("UpdateOrder: update table failed %w", err)
 	}
 
+	// Сохранение перехода в историю, повторный опрос с тем же статусом историю не меняет
+	if ord.Status != prevStatus {
+		if err := insertStatusChange(ctx, tx, ord.ID, ord.Status, ord.Accrual); err != nil {
+			return fmt.Errorf("UpdateOrder: %w", err)
+		}
+	}
+
+	// Заказ в итоговом статусе больше не опрашивается
+	if ord.Status == order.StatusProcessed || ord.Status == order.StatusInvalid {
+		if err := deleteOrderJob(ctx, tx, ord.ID); err != nil {
+			return fmt.Errorf("UpdateOrder: %w", err)
+		}
+	}
+
 	// Сохранение информации о начислении, если заказ обработан
 	if ord.Status == "PROCESSED" {
-		if _, err := tx.ExecContext(ctx, `INSERT INTO balances 
-		(action, amount, user_id, order_number) VALUES ('ACCRUAL', $1, $2, $3)`,
-			ord.Accrual, ord.UserID, ord.Number); err != nil {
+		var balanceID int
+		row := tx.QueryRowContext(ctx, `INSERT INTO balances 
+		(action, amount, user_id, order_number) VALUES ('ACCRUAL', $1, $2, $3) RETURNING id`,
+			ord.Accrual, ord.UserID, ord.Number)
+		if err := row.Scan(&balanceID); err != nil {
 			var pgErr *pgconn.PgError
 			if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
 				return fmt.Errorf("UpdateOrder: %w", errs.ErrOrderAlreadyProcessed)
 			}
 			return fmt.Errorf("UpdateOrder: insert into balances failed %w", err)
 		}
+
+		// Зачисление на счёт пользователя
+		if _, err := tx.ExecContext(ctx, `INSERT INTO accounts (user_id, current) VALUES ($1, $2) 
+		ON CONFLICT (user_id) DO UPDATE SET current = accounts.current + EXCLUDED.current, updated_at = NOW()`,
+			ord.UserID, ord.Accrual); err != nil {
+			return fmt.Errorf("UpdateOrder: update accounts failed %w", err)
+		}
+
+		// Запись проводки в книгу
+		if err := post(utils.WithTx(ctx, tx), balanceID); err != nil {
+			return fmt.Errorf("UpdateOrder: post to ledger failed %w", err)
+		}
 	}
 
 	// Подтверждение транзакции
@@ -145,34 +293,114 @@ func (r *Repository) UpdateOrder(ctx context.Context, ord *order.Order) error {
 	return nil
 }
 
-// GetUnprocessedOrders возвращает список всех необработанных заказов
-func (r *Repository) GetUnprocessedOrders(ctx context.Context) ([]*order.Order, error) {
+// ResetOrder возвращает ещё не обработанный или недействительный заказ в статус NEW
+// для повторной проверки в системе начисления баллов
+func (r *Repository) ResetOrder(ctx context.Context, number string) error {
 	// Проверка базы данных
 	if err := r.db.PingContext(ctx); err != nil {
-		return nil, fmt.Errorf("GetUnprocessedOrders: connection to database in died %w", err)
+		return fmt.Errorf("ResetOrder: connection to database in died %w", err)
 	}
 
-	// Получение данных заказа
-	rows, err := r.db.QueryContext(ctx, `SELECT id, number, user_id, status, accrual, created_at FROM orders 
-	WHERE status NOT IN ('PROCESSED', 'INVALID') LIMIT 10`)
+	// Начало транзакции
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("ResetOrder: begin transaction failed %w", err)
+	}
+	defer tx.Rollback()
+
+	// Проверка текущего статуса заказа
+	var status string
+	row := tx.QueryRowContext(ctx, `SELECT status FROM orders WHERE number = $1 FOR UPDATE`, number)
+	err = row.Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("ResetOrder: %w", errs.ErrOrderNotFound)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("GetUnprocessedOrders: read rows from table failed %w", err)
+		return fmt.Errorf("ResetOrder: scan order row failed %w", err)
+	}
+	if status == "PROCESSED" {
+		return fmt.Errorf("ResetOrder: %w", errs.ErrOrderAlreadyProcessed)
+	}
+
+	// Выполнение запроса к базе данных
+	var orderID int
+	if err := tx.QueryRowContext(ctx, `UPDATE orders SET status = 'NEW', accrual = 0 
+	WHERE number = $1 RETURNING id`, number).Scan(&orderID); err != nil {
+		return fmt.Errorf("ResetOrder: update table failed %w", err)
+	}
+	if err := insertStatusChange(ctx, tx, orderID, order.StatusNew, 0); err != nil {
+		return fmt.Errorf("ResetOrder: %w", err)
+	}
+	if err := enqueueJob(ctx, tx, orderID); err != nil {
+		return fmt.Errorf("ResetOrder: %w", err)
+	}
+
+	// Подтверждение транзакции
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ResetOrder: commit transaction failed %w", err)
+	}
+
+	return nil
+}
+
+// GetOrder возвращает заказ пользователя по номеру
+func (r *Repository) GetOrder(ctx context.Context, userID int, number string) (*order.Order, error) {
+	// Проверка базы данных
+	if err := r.db.PingContext(ctx); err != nil {
+		return nil, fmt.Errorf("GetOrder: connection to database in died %w", err)
+	}
+
+	// Заказ другого пользователя считается ненайденным
+	var ord order.Order
+	row := r.db.QueryRowContext(ctx, `SELECT id, number, user_id, status, accrual, created_at 
+	FROM orders WHERE number = $1 AND user_id = $2`, number, userID)
+	if err := row.Scan(&ord.ID, &ord.Number, &ord.UserID, &ord.Status, &ord.Accrual, &ord.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("GetOrder: %w", errs.ErrOrderNotFound)
+		}
+		return nil, fmt.Errorf("GetOrder: scan row failed %w", err)
+	}
+
+	return &ord, nil
+}
+
+// GetStatusHistory возвращает историю изменения статуса заказа в хронологическом порядке
+func (r *Repository) GetStatusHistory(ctx context.Context, orderID int) ([]*order.StatusChange, error) {
+	// Проверка базы данных
+	if err := r.db.PingContext(ctx); err != nil {
+		return nil, fmt.Errorf("GetStatusHistory: connection to database in died %w", err)
+	}
+
+	// Порядок определяется идентификатором, так как у перенесённых записей время перехода не задано
+	rows, err := r.db.QueryContext(ctx, `SELECT status, accrual, created_at FROM order_status_history 
+	WHERE order_id = $1 ORDER BY id`, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("GetStatusHistory: read rows from table failed %w", err)
 	}
 	defer rows.Close()
 
-	storedOrders := make([]*order.Order, 0)
+	history := make([]*order.StatusChange, 0)
 	for rows.Next() {
-		var ord order.Order
-		if err := rows.Scan(&ord.ID, &ord.Number, &ord.UserID, &ord.Status, &ord.Accrual, &ord.CreatedAt); err != nil {
-			return nil, fmt.Errorf("GetUnprocessedOrders: scan row failed %w", err)
+		var c order.StatusChange
+		if err := rows.Scan(&c.Status, &c.Accrual, &c.CreatedAt); err != nil {
+			return nil, fmt.Errorf("GetStatusHistory: scan row failed %w", err)
 		}
-		storedOrders = append(storedOrders, &ord)
+		history = append(history, &c)
 	}
 
 	err = rows.Err()
 	if err != nil {
-		return nil, fmt.Errorf("GetUnprocessedOrders: rows.Err %w", err)
+		return nil, fmt.Errorf("GetStatusHistory: rows.Err %w", err)
 	}
 
-	return storedOrders, nil
+	return history, nil
+}
+
+// insertStatusChange сохраняет переход заказа в новый статус в рамках транзакции
+func insertStatusChange(ctx context.Context, tx *sql.Tx, orderID int, status string, accrual utils.Money) error {
+	if _, err := tx.ExecContext(ctx, `INSERT INTO order_status_history (order_id, status, accrual) 
+	VALUES ($1, $2, $3)`, orderID, status, accrual); err != nil {
+		return fmt.Errorf("insertStatusChange: insert into order_status_history failed %w", err)
+	}
+	return nil
 }
@@ -2,20 +2,27 @@ package order
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strconv"
+	"time"
 
+	"github.com/pavlegich/gophermart/internal/domains/ledger"
 	errs "github.com/pavlegich/gophermart/internal/errors"
 	"github.com/pavlegich/gophermart/internal/utils"
 )
 
 type OrderService struct {
-	repo Repository
+	repo   Repository
+	ledger ledger.Service
 }
 
-func NewOrderService(repo Repository) *OrderService {
+// NewOrderService создаёт сервис заказов; проводки начислений записываются через сервис книги баллов
+// в транзакции обновления заказа
+func NewOrderService(repo Repository, l ledger.Service) *OrderService {
 	return &OrderService{
-		repo: repo,
+		repo:   repo,
+		ledger: l,
 	}
 }
 
@@ -36,6 +43,61 @@ func (s *OrderService) Create(ctx context.Context, ord *Order) error {
 	return nil
 }
 
+// CreateBatch проверяет и сохраняет пакет заказов пользователя, возвращая результат по каждому номеру
+func (s *OrderService) CreateBatch(ctx context.Context, userID int, numbers []string) ([]*BatchItem, error) {
+	if len(numbers) == 0 || len(numbers) > BatchMaxSize {
+		return nil, fmt.Errorf("CreateBatch: batch size %d %w", len(numbers), errs.ErrIncorrectBatch)
+	}
+
+	items := make([]*BatchItem, 0, len(numbers))
+	orders := make([]*Order, 0, len(numbers))
+	pending := make([]*BatchItem, 0, len(numbers))
+	seen := make(map[string]bool, len(numbers))
+	for _, number := range numbers {
+		item := &BatchItem{Number: number}
+		items = append(items, item)
+
+		// Проверка корректности номера заказа
+		orderNumber, err := strconv.Atoi(number)
+		if err != nil || !utils.LuhnValid(orderNumber) {
+			item.Result = BatchInvalidFormat
+			continue
+		}
+		// Повтор номера в пакете считается уже загруженным заказом
+		if seen[number] {
+			item.Result = BatchAlreadyUploaded
+			continue
+		}
+		seen[number] = true
+
+		orders = append(orders, &Order{Number: number, UserID: userID})
+		pending = append(pending, item)
+	}
+	if len(orders) == 0 {
+		return items, nil
+	}
+
+	// Сохранение заказов одной транзакцией
+	results, err := s.repo.CreateOrders(ctx, orders)
+	if err != nil {
+		return nil, fmt.Errorf("CreateBatch: create orders failed %w", err)
+	}
+	for i, err := range results {
+		switch {
+		case err == nil:
+			pending[i].Result = BatchAccepted
+		case errors.Is(err, errs.ErrOrderAlreadyUpload):
+			pending[i].Result = BatchAlreadyUploaded
+		case errors.Is(err, errs.ErrOrderUploadByAnother):
+			pending[i].Result = BatchUploadedByAnother
+		default:
+			return nil, fmt.Errorf("CreateBatch: unexpected order result %w", err)
+		}
+	}
+
+	return items, nil
+}
+
 // List возвращает список заказов для пользователя
 func (s *OrderService) List(ctx context.Context, userID int) ([]*Order, error) {
 	orders, err := s.repo.GetAllOrders(ctx, userID)
@@ -48,6 +110,43 @@ func (s *OrderService) List(ctx context.Context, userID int) ([]*Order, error) {
 	return orders, nil
 }
 
+// ListPage возвращает страницу заказов пользователя и курсор следующей страницы
+func (s *OrderService) ListPage(ctx context.Context, userID int, f *ListFilter) ([]*Order, *utils.Cursor, error) {
+	for _, status := range f.Statuses {
+		switch status {
+		case StatusNew, StatusProcessing, StatusInvalid, StatusProcessed:
+		default:
+			return nil, nil, fmt.Errorf("ListPage: unknown status %s %w", status, errs.ErrIncorrectOrderFilter)
+		}
+	}
+	if !f.Normalize(ListDefaultLimit, ListMaxLimit) {
+		return nil, nil, fmt.Errorf("ListPage: %w", errs.ErrIncorrectOrderFilter)
+	}
+
+	orders, next, err := utils.FetchPage(&f.Page, func() ([]*Order, error) {
+		return s.repo.GetOrdersPage(ctx, userID, f)
+	}, func(o *Order) utils.Cursor {
+		return utils.Cursor{CreatedAt: o.CreatedAt, ID: o.ID}
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("ListPage: get orders page failed %w", err)
+	}
+	return orders, next, nil
+}
+
+// Get возвращает заказ пользователя и историю изменения его статуса
+func (s *OrderService) Get(ctx context.Context, userID int, number string) (*Order, []*StatusChange, error) {
+	ord, err := s.repo.GetOrder(ctx, userID, number)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Get: get order failed %w", err)
+	}
+	history, err := s.repo.GetStatusHistory(ctx, ord.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Get: get status history failed %w", err)
+	}
+	return ord, history, nil
+}
+
 // Upload обрабатывает и сохраняет заказ в хранилище
 func (s *OrderService) Upload(ctx context.Context, ord *Order) error {
 	orderNumber, err := strconv.Atoi(ord.Number)
@@ -57,20 +156,78 @@ func (s *OrderService) Upload(ctx context.Context, ord *Order) error {
 	if !utils.LuhnValid(orderNumber) {
 		return fmt.Errorf("Upload: luhn check failed %w", errs.ErrIncorrectNumberFormat)
 	}
-	if err := s.repo.UpdateOrder(ctx, ord); err != nil {
+	err = s.repo.UpdateOrder(ctx, ord, func(ctx context.Context, balanceID int) error {
+		// Заказ без начисления не двигает баллы
+		if ord.Accrual <= 0 {
+			return nil
+		}
+		posting := ledger.NewAccrual(ord.UserID, ord.Accrual, ord.Number)
+		posting.BalanceID = balanceID
+		return s.ledger.Post(ctx, posting)
+	})
+	if err != nil {
 		return fmt.Errorf("Upload: save order failed %w", err)
 	}
 	return nil
 }
 
-// ListUnprocessed возвращает список всех ещё необработанных заказов
-func (s *OrderService) ListUnprocessed(ctx context.Context) ([]*Order, error) {
-	orders, err := s.repo.GetUnprocessedOrders(ctx)
+// ClaimJob захватывает следующую задачу опроса системы начисления баллов
+func (s *OrderService) ClaimJob(ctx context.Context, lease time.Duration) (*Job, error) {
+	job, err := s.repo.ClaimJob(ctx, lease)
 	if err != nil {
-		return nil, fmt.Errorf("ListUnprocessed: get orders list failed %w", err)
+		return nil, fmt.Errorf("ClaimJob: claim job failed %w", err)
 	}
-	if len(orders) == 0 {
-		return nil, fmt.Errorf("ListUnprocessed: no orders found failed %w", errs.ErrOrdersNotFound)
+	return job, nil
+}
+
+// RetryJob откладывает следующую попытку опроса по задаче с экспоненциальной задержкой;
+// попытки, на которые система начисления ответила о заказе (counted: не зарегистрирован, REGISTERED
+// или PROCESSING), увеличивают задержку и расходуют лимит попыток, а ограничение запросов
+// и недоступность системы начисления — нет. Задача с исчерпанными попытками или превысившая срок опроса
+// при любом исходе попытки переводится в статус STALE
+func (s *OrderService) RetryJob(ctx context.Context, job *Job, policy *RetryPolicy, minDelay time.Duration,
+	counted bool) error {
+	if counted {
+		job.Attempts++
 	}
-	return orders, nil
+	if (counted && policy.Exhausted(job)) || policy.Expired(job) {
+		if err := s.repo.MarkJobStale(ctx, job); err != nil {
+			return fmt.Errorf("RetryJob: mark job stale failed %w", err)
+		}
+		return fmt.Errorf("RetryJob: attempts %d %w", job.Attempts, errs.ErrJobStale)
+	}
+
+	delay := policy.Delay(job.Attempts)
+	if minDelay > delay {
+		delay = minDelay
+	}
+	if err := s.repo.RetryJob(ctx, job, delay); err != nil {
+		return fmt.Errorf("RetryJob: retry job failed %w", err)
+	}
+	return nil
+}
+
+// CompleteJob удаляет задачу, опрос по которой больше не нужен
+func (s *OrderService) CompleteJob(ctx context.Context, job *Job) error {
+	if err := s.repo.DeleteJob(ctx, job); err != nil {
+		return fmt.Errorf("CompleteJob: delete job failed %w", err)
+	}
+	return nil
+}
+
+// ListStaleJobs возвращает задачи, опрос по которым остановлен
+func (s *OrderService) ListStaleJobs(ctx context.Context) ([]*Job, error) {
+	jobs, err := s.repo.GetStaleJobs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ListStaleJobs: get stale jobs failed %w", err)
+	}
+	return jobs, nil
+}
+
+// RequeueJob возвращает остановленную задачу заказа в очередь
+func (s *OrderService) RequeueJob(ctx context.Context, number string) error {
+	if err := s.repo.RequeueJob(ctx, number); err != nil {
+		return fmt.Errorf("RequeueJob: requeue job failed %w", err)
+	}
+	return nil
 }
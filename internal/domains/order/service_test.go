@@ -0,0 +1,161 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pavlegich/gophermart/internal/domains/ledger"
+	errs "github.com/pavlegich/gophermart/internal/errors"
+	"github.com/pavlegich/gophermart/internal/utils"
+)
+
+// fakeJobRepo запоминает, как была отложена или остановлена задача
+type fakeJobRepo struct {
+	Repository
+	stale   bool
+	delay   time.Duration
+	retried bool
+}
+
+func (f *fakeJobRepo) RetryJob(ctx context.Context, job *Job, delay time.Duration) error {
+	f.retried = true
+	f.delay = delay
+	return nil
+}
+
+func (f *fakeJobRepo) MarkJobStale(ctx context.Context, job *Job) error {
+	f.stale = true
+	return nil
+}
+
+// fakeOrderRepo записывает начисление за обработанный заказ так же, как хранилище внутри транзакции
+type fakeOrderRepo struct {
+	Repository
+}
+
+func (f *fakeOrderRepo) UpdateOrder(ctx context.Context, ord *Order,
+	post func(ctx context.Context, balanceID int) error) error {
+	return post(ctx, 11)
+}
+
+// fakeLedger запоминает записанные проводки
+type fakeLedger struct {
+	ledger.Service
+	postings []*ledger.Posting
+}
+
+func (f *fakeLedger) Post(ctx context.Context, p *ledger.Posting) error {
+	f.postings = append(f.postings, p)
+	return nil
+}
+
+func TestUploadPostsAccrual(t *testing.T) {
+	tests := []struct {
+		name        string
+		accrual     int64
+		wantPosting bool
+	}{
+		{
+			name:        "accrual",
+			accrual:     50012,
+			wantPosting: true,
+		},
+		{
+			name:    "zero_accrual",
+			accrual: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &fakeLedger{}
+			s := NewOrderService(&fakeOrderRepo{}, l)
+			ord := &Order{Number: "79927398713", UserID: 7, Status: StatusProcessed, Accrual: utils.Money(tt.accrual)}
+
+			if err := s.Upload(context.Background(), ord); err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if !tt.wantPosting {
+				if len(l.postings) != 0 {
+					t.Fatalf("expected no postings, got %+v", l.postings)
+				}
+				return
+			}
+			if len(l.postings) != 1 || l.postings[0].Kind != ledger.KindAccrual || l.postings[0].BalanceID != 11 {
+				t.Fatalf("expected accrual posting for balance 11, got %+v", l.postings)
+			}
+		})
+	}
+}
+
+func TestRetryJob(t *testing.T) {
+	policy := &RetryPolicy{Base: time.Second, Max: time.Hour, MaxAttempts: 5, MaxAge: time.Hour}
+	tests := []struct {
+		name      string
+		attempts  int
+		age       time.Duration
+		counted   bool
+		minDelay  time.Duration
+		wantStale bool
+		wantDelay time.Duration
+	}{
+		{
+			name:      "processing_backoff",
+			attempts:  3,
+			age:       time.Minute,
+			counted:   true,
+			wantDelay: 8 * time.Second,
+		},
+		{
+			name:      "processing_past_max_age",
+			attempts:  1,
+			age:       2 * time.Hour,
+			counted:   true,
+			wantStale: true,
+		},
+		{
+			name:      "server_error_past_max_age",
+			attempts:  0,
+			age:       2 * time.Hour,
+			counted:   false,
+			wantStale: true,
+		},
+		{
+			name:      "attempts_exhausted",
+			attempts:  4,
+			age:       time.Minute,
+			counted:   true,
+			wantStale: true,
+		},
+		{
+			name:      "rate_limited_not_counted",
+			attempts:  4,
+			age:       time.Minute,
+			counted:   false,
+			minDelay:  time.Minute,
+			wantDelay: time.Minute,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeJobRepo{}
+			s := NewOrderService(repo, nil)
+			job := &Job{ID: 1, Attempts: tt.attempts, CreatedAt: time.Now().Add(-tt.age)}
+
+			err := s.RetryJob(context.Background(), job, policy, tt.minDelay, tt.counted)
+			if tt.wantStale {
+				if !errors.Is(err, errs.ErrJobStale) || !repo.stale || repo.retried {
+					t.Fatalf("expected job to be marked stale, got err %v stale %v", err, repo.stale)
+				}
+				return
+			}
+			if err != nil || repo.stale || !repo.retried {
+				t.Fatalf("expected job to be retried, got err %v stale %v", err, repo.stale)
+			}
+			if repo.delay != tt.wantDelay {
+				t.Fatalf("expected delay %s, got %s", tt.wantDelay, repo.delay)
+			}
+		})
+	}
+}
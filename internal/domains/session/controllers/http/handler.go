@@ -0,0 +1,139 @@
+package http
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pavlegich/gophermart/internal/domains/session"
+	repo "github.com/pavlegich/gophermart/internal/domains/session/repository"
+	errs "github.com/pavlegich/gophermart/internal/errors"
+	"github.com/pavlegich/gophermart/internal/infra/config"
+	"github.com/pavlegich/gophermart/internal/infra/logger"
+	"github.com/pavlegich/gophermart/internal/utils"
+	"go.uber.org/zap"
+)
+
+type SessionHandler struct {
+	Config  *config.Config
+	Service session.Service
+}
+
+type responseSession struct {
+	ID        string `json:"id"`
+	UserAgent string `json:"user_agent"`
+	CreatedAt string `json:"created_at"`
+	ExpiresAt string `json:"expires_at"`
+	Current   bool   `json:"current"`
+}
+
+// Activate активирует обработчик запросов для сессий
+func Activate(public chi.Router, protected chi.Router, cfg *config.Config, db *sql.DB) {
+	s := session.NewSessionService(repo.NewSessionRepo(db))
+	newHandler(public, protected, cfg, s)
+}
+
+// newHandler инициализирует обработчик запросов для сессий
+func newHandler(public chi.Router, protected chi.Router, cfg *config.Config, s session.Service) {
+	h := SessionHandler{
+		Config:  cfg,
+		Service: s,
+	}
+	protected.Get("/api/user/sessions", h.HandleSessionsGet)
+	protected.Post("/api/user/sessions/revoke-all", h.HandleSessionsRevokeAll)
+}
+
+// HandleSessionsGet передаёт список активных сессий пользователя
+func (h *SessionHandler) HandleSessionsGet(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, err := utils.GetUserIDFromContext(ctx)
+	idString := strconv.Itoa(userID)
+	if err != nil {
+		logger.Log.With(zap.String("user_id", idString)).Error("HandleSessionsGet: get user id from context failed")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	currentID, err := utils.GetSessionIDFromContext(ctx)
+	if err != nil {
+		logger.Log.With(zap.String("user_id", idString)).Error("HandleSessionsGet: get session id from context failed")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	sessionsList, err := h.Service.List(ctx, userID)
+	if err != nil {
+		if errors.Is(err, errs.ErrSessionNotFound) {
+			w.WriteHeader(http.StatusNoContent)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		logger.Log.With(zap.String("user_id", idString)).Error("HandleSessionsGet: get sessions list failed",
+			zap.Error(err))
+		return
+	}
+
+	resp := make([]responseSession, 0)
+	for _, s := range sessionsList {
+		resp = append(resp, responseSession{
+			ID:        s.ID,
+			UserAgent: s.UserAgent,
+			CreatedAt: s.CreatedAt.Format(time.RFC3339),
+			ExpiresAt: s.ExpiresAt.Format(time.RFC3339),
+			Current:   s.ID == currentID,
+		})
+	}
+
+	respJSON, err := json.Marshal(resp)
+	if err != nil {
+		logger.Log.With(zap.String("user_id", idString)).Error("HandleSessionsGet: response marshal failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(respJSON))
+}
+
+// HandleSessionsRevokeAll отзывает все сессии пользователя, включая текущую
+func (h *SessionHandler) HandleSessionsRevokeAll(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, err := utils.GetUserIDFromContext(ctx)
+	idString := strconv.Itoa(userID)
+	if err != nil {
+		logger.Log.With(zap.String("user_id", idString)).Error("HandleSessionsRevokeAll: get user id from context failed")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.Service.RevokeAll(ctx, userID); err != nil {
+		logger.Log.With(zap.String("user_id", idString)).Error("HandleSessionsRevokeAll: revoke sessions failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name: "auth",
+		Path: "/api/",
+		// Secure:   true,
+		HttpOnly: true,
+		MaxAge:   -1,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name: "refresh",
+		Path: "/api/user/token/",
+		// Secure:   true,
+		HttpOnly: true,
+		MaxAge:   -1,
+	})
+
+	w.WriteHeader(http.StatusOK)
+}
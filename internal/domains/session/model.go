@@ -0,0 +1,33 @@
+package session
+
+import (
+	"context"
+	"time"
+)
+
+type Session struct {
+	ID        string     `json:"id"`
+	UserID    int        `json:"user_id,omitempty"`
+	UserAgent string     `json:"user_agent"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+type Service interface {
+	Create(ctx context.Context, session *Session) (string, error)
+	Refresh(ctx context.Context, refreshToken string, expiresAt time.Time) (*Session, string, error)
+	Check(ctx context.Context, id string, userID int) error
+	Revoke(ctx context.Context, id string, userID int) error
+	RevokeAll(ctx context.Context, userID int) error
+	List(ctx context.Context, userID int) ([]*Session, error)
+}
+
+type Repository interface {
+	CreateSession(ctx context.Context, session *Session, tokenHash string) error
+	RotateRefreshToken(ctx context.Context, oldHash string, newHash string, expiresAt time.Time) (*Session, error)
+	GetSession(ctx context.Context, id string) (*Session, error)
+	RevokeSession(ctx context.Context, id string, userID int) error
+	RevokeAllSessions(ctx context.Context, userID int) error
+	GetActiveSessions(ctx context.Context, userID int) ([]*Session, error)
+}
@@ -0,0 +1,232 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pavlegich/gophermart/internal/domains/session"
+	errs "github.com/pavlegich/gophermart/internal/errors"
+)
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewSessionRepo(db *sql.DB) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+// CreateSession сохраняет данные новой сессии и её первый токен обновления в хранилище
+func (r *Repository) CreateSession(ctx context.Context, sess *session.Session, tokenHash string) error {
+	// Проверка базы данных
+	if err := r.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("CreateSession: connection to database in died %w", err)
+	}
+
+	// Начало транзакции
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("CreateSession: begin transaction failed %w", err)
+	}
+	defer tx.Rollback()
+
+	// Выполнение запроса к базе данных
+	row := tx.QueryRowContext(ctx, `INSERT INTO sessions (id, user_id, user_agent, expires_at) 
+	VALUES ($1, $2, $3, $4) RETURNING created_at`,
+		sess.ID, sess.UserID, sess.UserAgent, sess.ExpiresAt)
+	if err := row.Scan(&sess.CreatedAt); err != nil {
+		return fmt.Errorf("CreateSession: insert into sessions failed %w", err)
+	}
+
+	// Сохранение токена обновления
+	if _, err := tx.ExecContext(ctx, `INSERT INTO refresh_tokens (session_id, token_hash, expires_at) 
+	VALUES ($1, $2, $3)`, sess.ID, tokenHash, sess.ExpiresAt); err != nil {
+		return fmt.Errorf("CreateSession: insert into refresh_tokens failed %w", err)
+	}
+
+	// Подтверждение транзакции
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("CreateSession: commit transaction failed %w", err)
+	}
+
+	return nil
+}
+
+// RotateRefreshToken помечает токен обновления использованным и выпускает новый в той же сессии;
+// при повторном предъявлении использованного токена сессия отзывается целиком
+func (r *Repository) RotateRefreshToken(ctx context.Context, oldHash string, newHash string,
+	expiresAt time.Time) (*session.Session, error) {
+	// Проверка базы данных
+	if err := r.db.PingContext(ctx); err != nil {
+		return nil, fmt.Errorf("RotateRefreshToken: connection to database in died %w", err)
+	}
+
+	// Начало транзакции
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("RotateRefreshToken: begin transaction failed %w", err)
+	}
+	defer tx.Rollback()
+
+	// Получение токена и его сессии с блокировкой
+	row := tx.QueryRowContext(ctx, `SELECT rt.id, rt.expires_at, rt.used_at, 
+	s.id, s.user_id, s.user_agent, s.created_at, s.expires_at, s.revoked_at 
+	FROM refresh_tokens rt JOIN sessions s ON s.id = rt.session_id 
+	WHERE rt.token_hash = $1 FOR UPDATE`, oldHash)
+
+	var token struct {
+		id        int
+		expiresAt time.Time
+		usedAt    *time.Time
+	}
+	var sess session.Session
+	err = row.Scan(&token.id, &token.expiresAt, &token.usedAt,
+		&sess.ID, &sess.UserID, &sess.UserAgent, &sess.CreatedAt, &sess.ExpiresAt, &sess.RevokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("RotateRefreshToken: %w", errs.ErrRefreshTokenInvalid)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("RotateRefreshToken: scan row failed %w", err)
+	}
+
+	if sess.RevokedAt != nil {
+		return nil, fmt.Errorf("RotateRefreshToken: %w", errs.ErrSessionRevoked)
+	}
+
+	// Повторное использование токена: отзыв всего семейства токенов
+	if token.usedAt != nil {
+		if _, err := tx.ExecContext(ctx, `UPDATE sessions SET revoked_at = NOW() WHERE id = $1`,
+			sess.ID); err != nil {
+			return nil, fmt.Errorf("RotateRefreshToken: revoke session failed %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("RotateRefreshToken: commit transaction failed %w", err)
+		}
+		return nil, fmt.Errorf("RotateRefreshToken: %w", errs.ErrRefreshTokenReused)
+	}
+
+	if !token.expiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("RotateRefreshToken: %w", errs.ErrRefreshTokenInvalid)
+	}
+
+	// Замена токена и продление сессии
+	if _, err := tx.ExecContext(ctx, `UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1`,
+		token.id); err != nil {
+		return nil, fmt.Errorf("RotateRefreshToken: mark token used failed %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO refresh_tokens (session_id, token_hash, expires_at) 
+	VALUES ($1, $2, $3)`, sess.ID, newHash, expiresAt); err != nil {
+		return nil, fmt.Errorf("RotateRefreshToken: insert into refresh_tokens failed %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE sessions SET expires_at = $1 WHERE id = $2`,
+		expiresAt, sess.ID); err != nil {
+		return nil, fmt.Errorf("RotateRefreshToken: update session failed %w", err)
+	}
+	sess.ExpiresAt = expiresAt
+
+	// Подтверждение транзакции
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("RotateRefreshToken: commit transaction failed %w", err)
+	}
+
+	return &sess, nil
+}
+
+// GetSession возвращает сессию по её идентификатору
+func (r *Repository) GetSession(ctx context.Context, id string) (*session.Session, error) {
+	// Проверка базы данных
+	if err := r.db.PingContext(ctx); err != nil {
+		return nil, fmt.Errorf("GetSession: connection to database in died %w", err)
+	}
+
+	// Выполнение запроса на получение строки с данными сессии
+	row := r.db.QueryRowContext(ctx, `SELECT id, user_id, user_agent, created_at, expires_at, revoked_at 
+	FROM sessions WHERE id = $1`, id)
+
+	var sess session.Session
+	err := row.Scan(&sess.ID, &sess.UserID, &sess.UserAgent, &sess.CreatedAt, &sess.ExpiresAt, &sess.RevokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("GetSession: scan row failed %w", errs.ErrSessionNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetSession: scan row failed %w", err)
+	}
+
+	return &sess, nil
+}
+
+// RevokeSession отзывает сессию пользователя
+func (r *Repository) RevokeSession(ctx context.Context, id string, userID int) error {
+	// Проверка базы данных
+	if err := r.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("RevokeSession: connection to database in died %w", err)
+	}
+
+	res, err := r.db.ExecContext(ctx, `UPDATE sessions SET revoked_at = NOW() 
+	WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`, id, userID)
+	if err != nil {
+		return fmt.Errorf("RevokeSession: update table failed %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("RevokeSession: get affected rows failed %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("RevokeSession: %w", errs.ErrSessionNotFound)
+	}
+
+	return nil
+}
+
+// RevokeAllSessions отзывает все действующие сессии пользователя
+func (r *Repository) RevokeAllSessions(ctx context.Context, userID int) error {
+	// Проверка базы данных
+	if err := r.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("RevokeAllSessions: connection to database in died %w", err)
+	}
+
+	if _, err := r.db.ExecContext(ctx, `UPDATE sessions SET revoked_at = NOW() 
+	WHERE user_id = $1 AND revoked_at IS NULL`, userID); err != nil {
+		return fmt.Errorf("RevokeAllSessions: update table failed %w", err)
+	}
+
+	return nil
+}
+
+// GetActiveSessions возвращает список действующих сессий пользователя
+func (r *Repository) GetActiveSessions(ctx context.Context, userID int) ([]*session.Session, error) {
+	// Проверка базы данных
+	if err := r.db.PingContext(ctx); err != nil {
+		return nil, fmt.Errorf("GetActiveSessions: connection to database in died %w", err)
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT id, user_id, user_agent, created_at, expires_at, revoked_at 
+	FROM sessions WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW() 
+	ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("GetActiveSessions: read rows from table failed %w", err)
+	}
+	defer rows.Close()
+
+	storedSessions := make([]*session.Session, 0)
+	for rows.Next() {
+		var sess session.Session
+		if err := rows.Scan(&sess.ID, &sess.UserID, &sess.UserAgent, &sess.CreatedAt,
+			&sess.ExpiresAt, &sess.RevokedAt); err != nil {
+			return nil, fmt.Errorf("GetActiveSessions: scan row failed %w", err)
+		}
+		storedSessions = append(storedSessions, &sess)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("GetActiveSessions: rows.Err %w", err)
+	}
+
+	return storedSessions, nil
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	errs "github.com/pavlegich/gophermart/internal/errors"
+)
+
+func TestRotateRefreshTokenReuse(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("create sqlmock failed %v", err)
+	}
+	defer db.Close()
+
+	r := NewSessionRepo(db)
+	ctx := context.Background()
+	now := time.Now()
+	expiresAt := now.Add(time.Hour)
+	tokenColumns := []string{"id", "expires_at", "used_at", "id", "user_id", "user_agent",
+		"created_at", "expires_at", "revoked_at"}
+	selectToken := regexp.QuoteMeta(`FROM refresh_tokens rt JOIN sessions s ON s.id = rt.session_id`)
+
+	// Первое предъявление токена: токен заменяется новым
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectToken).WithArgs("old").
+		WillReturnRows(sqlmock.NewRows(tokenColumns).
+			AddRow(1, expiresAt, nil, "sid", 7, "agent", now, expiresAt, nil))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE refresh_tokens SET used_at = NOW()`)).WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO refresh_tokens`)).WithArgs("sid", "new", expiresAt).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE sessions SET expires_at`)).WithArgs(expiresAt, "sid").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	sess, err := r.RotateRefreshToken(ctx, "old", "new", expiresAt)
+	if err != nil {
+		t.Fatalf("first rotation failed %v", err)
+	}
+	if sess.ID != "sid" {
+		t.Fatalf("unexpected session %s", sess.ID)
+	}
+
+	// Повторное предъявление того же токена: сессия отзывается целиком
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectToken).WithArgs("old").
+		WillReturnRows(sqlmock.NewRows(tokenColumns).
+			AddRow(1, expiresAt, now, "sid", 7, "agent", now, expiresAt, nil))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE sessions SET revoked_at = NOW() WHERE id = $1`)).WithArgs("sid").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	_, err = r.RotateRefreshToken(ctx, "old", "newer", expiresAt)
+	if !errors.Is(err, errs.ErrRefreshTokenReused) {
+		t.Fatalf("expected reuse error, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("session was not revoked %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	errs "github.com/pavlegich/gophermart/internal/errors"
+	"github.com/pavlegich/gophermart/internal/infra/hash"
+)
+
+type SessionService struct {
+	repo Repository
+}
+
+func NewSessionService(repo Repository) *SessionService {
+	return &SessionService{
+		repo: repo,
+	}
+}
+
+// Create сохраняет новую сессию пользователя в хранилище и возвращает первый токен обновления
+func (s *SessionService) Create(ctx context.Context, sess *Session) (string, error) {
+	sessionID, err := hash.RandomToken(16)
+	if err != nil {
+		return "", fmt.Errorf("Create: generate session id failed %w", err)
+	}
+	sess.ID = sessionID
+
+	refreshToken, err := hash.RandomToken(32)
+	if err != nil {
+		return "", fmt.Errorf("Create: generate refresh token failed %w", err)
+	}
+
+	if err := s.repo.CreateSession(ctx, sess, hash.Sum(refreshToken)); err != nil {
+		return "", fmt.Errorf("Create: save session failed %w", err)
+	}
+	return refreshToken, nil
+}
+
+// Refresh обменивает одноразовый токен обновления на новый и продлевает сессию;
+// повторное использование токена приводит к отзыву всей сессии
+func (s *SessionService) Refresh(ctx context.Context, refreshToken string, expiresAt time.Time) (*Session, string, error) {
+	if refreshToken == "" {
+		return nil, "", fmt.Errorf("Refresh: %w", errs.ErrRefreshTokenInvalid)
+	}
+
+	newToken, err := hash.RandomToken(32)
+	if err != nil {
+		return nil, "", fmt.Errorf("Refresh: generate refresh token failed %w", err)
+	}
+
+	sess, err := s.repo.RotateRefreshToken(ctx, hash.Sum(refreshToken), hash.Sum(newToken), expiresAt)
+	if err != nil {
+		return nil, "", fmt.Errorf("Refresh: rotate refresh token failed %w", err)
+	}
+	return sess, newToken, nil
+}
+
+// Check проверяет, что сессия принадлежит пользователю и всё ещё действует
+func (s *SessionService) Check(ctx context.Context, id string, userID int) error {
+	sess, err := s.repo.GetSession(ctx, id)
+	if err != nil {
+		return fmt.Errorf("Check: get session failed %w", err)
+	}
+	if sess.UserID != userID {
+		return fmt.Errorf("Check: %w", errs.ErrSessionNotFound)
+	}
+	if sess.RevokedAt != nil {
+		return fmt.Errorf("Check: %w", errs.ErrSessionRevoked)
+	}
+	if !sess.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("Check: %w", errs.ErrSessionExpired)
+	}
+	return nil
+}
+
+// Revoke отзывает сессию пользователя
+func (s *SessionService) Revoke(ctx context.Context, id string, userID int) error {
+	if err := s.repo.RevokeSession(ctx, id, userID); err != nil {
+		return fmt.Errorf("Revoke: revoke session failed %w", err)
+	}
+	return nil
+}
+
+// RevokeAll отзывает все сессии пользователя
+func (s *SessionService) RevokeAll(ctx context.Context, userID int) error {
+	if err := s.repo.RevokeAllSessions(ctx, userID); err != nil {
+		return fmt.Errorf("RevokeAll: revoke sessions failed %w", err)
+	}
+	return nil
+}
+
+// List возвращает список активных сессий пользователя
+func (s *SessionService) List(ctx context.Context, userID int) ([]*Session, error) {
+	sessions, err := s.repo.GetActiveSessions(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("List: get sessions failed %w", err)
+	}
+	if len(sessions) == 0 {
+		return nil, fmt.Errorf("List: %w", errs.ErrSessionNotFound)
+	}
+	return sessions, nil
+}
@@ -5,37 +5,61 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/pavlegich/gophermart/internal/domains/session"
+	sessionRepo "github.com/pavlegich/gophermart/internal/domains/session/repository"
 	"github.com/pavlegich/gophermart/internal/domains/user"
 	repo "github.com/pavlegich/gophermart/internal/domains/user/repository"
 	errs "github.com/pavlegich/gophermart/internal/errors"
 	"github.com/pavlegich/gophermart/internal/infra/config"
+	"github.com/pavlegich/gophermart/internal/infra/hash"
 	"github.com/pavlegich/gophermart/internal/infra/logger"
+	"github.com/pavlegich/gophermart/internal/utils"
 	"go.uber.org/zap"
 )
 
-type UserHandler struct {
-	Config  *config.Config
-	Service user.Service
-}
+type (
+	UserHandler struct {
+		Config   *config.Config
+		Service  user.Service
+		Sessions session.Service
+	}
+
+	requestRefresh struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	responseTokens struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+	}
+)
 
 // Activate активирует обработчик запросов для пользователя
-func Activate(r *chi.Mux, cfg *config.Config, db *sql.DB) {
+func Activate(public chi.Router, protected chi.Router, cfg *config.Config, db *sql.DB) {
 	s := user.NewUserService(repo.NewUserRepo(db))
-	newHandler(r, cfg, s)
+	ss := session.NewSessionService(sessionRepo.NewSessionRepo(db))
+	newHandler(public, protected, cfg, s, ss)
 }
 
 // newHandler инициализирует обработчик запросов для пользователя
-func newHandler(r *chi.Mux, cfg *config.Config, s user.Service) {
+func newHandler(public chi.Router, protected chi.Router, cfg *config.Config, s user.Service, ss session.Service) {
 	h := UserHandler{
-		Config:  cfg,
-		Service: s,
+		Config:   cfg,
+		Service:  s,
+		Sessions: ss,
 	}
-	r.Post("/api/user/register", h.HandleRegister)
-	r.Post("/api/user/login", h.HandleLogin)
-	r.Post("/api/user/logout", h.HandleLogout)
+	public.Post("/api/user/register", h.HandleRegister)
+	public.Post("/api/user/login", h.HandleLogin)
+	protected.Post("/api/user/logout", h.HandleLogout)
+	public.Post("/api/user/token/refresh", h.HandleTokenRefresh)
 }
 
 // HandleRegister регистрирует нового пользователя
@@ -70,24 +94,15 @@ func (h *UserHandler) HandleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := h.Config.JWT.Create(ctx, req.ID)
+	token, refreshToken, err := h.startSession(r, &req)
 	if err != nil {
-		logger.Log.Error("HandleRegister: build token failed",
+		logger.Log.Error("HandleRegister: start session failed",
 			zap.Error(err))
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	cookie := http.Cookie{
-		Name:  "auth",
-		Value: token,
-		Path:  "/api/user/",
-		// Secure:   true,
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
-	}
-	http.SetCookie(w, &cookie)
-	w.WriteHeader(http.StatusOK)
+	h.writeTokens(w, r, token, refreshToken)
 }
 
 // HandleLogin авторизует пользователя по полученным данным
@@ -117,6 +132,8 @@ func (h *UserHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusUnauthorized)
 		} else if errors.Is(err, errs.ErrPasswordNotMatch) {
 			w.WriteHeader(http.StatusUnauthorized)
+		} else if errors.Is(err, errs.ErrUserBlocked) {
+			w.WriteHeader(http.StatusForbidden)
 		} else {
 			w.WriteHeader(http.StatusInternalServerError)
 		}
@@ -125,35 +142,213 @@ func (h *UserHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := h.Config.JWT.Create(ctx, storedUser.ID)
+	token, refreshToken, err := h.startSession(r, storedUser)
+	if err != nil {
+		logger.Log.Error("HandleLogin: start session failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	h.writeTokens(w, r, token, refreshToken)
+}
+
+// HandleLogout проводит операцию выхода из системы для пользователя
+func (h *UserHandler) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		logger.Log.Error("HandleLogout: get user id from context failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	sessionID, err := utils.GetSessionIDFromContext(ctx)
+	if err != nil {
+		logger.Log.Error("HandleLogout: get session id from context failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.Sessions.Revoke(ctx, sessionID, userID); err != nil && !errors.Is(err, errs.ErrSessionNotFound) {
+		logger.Log.Error("HandleLogout: revoke session failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	clearAuthCookies(w)
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleTokenRefresh обменивает токен обновления на новую пару токенов
+func (h *UserHandler) HandleTokenRefresh(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req requestRefresh
+	var buf bytes.Buffer
+
+	if _, err := buf.ReadFrom(r.Body); err != nil {
+		logger.Log.Error("HandleTokenRefresh: read request body failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+	if buf.Len() > 0 {
+		if err := json.Unmarshal(buf.Bytes(), &req); err != nil {
+			logger.Log.Error("HandleTokenRefresh: request unmarshal failed",
+				zap.Error(err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Токен из тела запроса имеет приоритет над cookie
+	if req.RefreshToken == "" {
+		cookie, err := r.Cookie("refresh")
+		if err != nil {
+			logger.Log.Error("HandleTokenRefresh: get refresh cookie failed",
+				zap.Error(err))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		req.RefreshToken = cookie.Value
+	}
+
+	sess, refreshToken, err := h.Sessions.Refresh(ctx, req.RefreshToken, time.Now().Add(h.Config.RefreshExp))
+	if err != nil {
+		if errors.Is(err, errs.ErrRefreshTokenInvalid) || errors.Is(err, errs.ErrRefreshTokenReused) ||
+			errors.Is(err, errs.ErrSessionRevoked) {
+			clearAuthCookies(w)
+			w.WriteHeader(http.StatusUnauthorized)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		logger.Log.Error("HandleTokenRefresh: refresh session failed",
+			zap.Error(err))
+		return
+	}
+
+	// Роль пользователя берётся из хранилища, чтобы её изменения вступали в силу при обновлении
+	storedUser, err := h.Service.Get(ctx, sess.UserID)
+	if err != nil {
+		logger.Log.Error("HandleTokenRefresh: get user failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if storedUser.BlockedAt != nil {
+		logger.Log.Error("HandleTokenRefresh: user is blocked",
+			zap.Int("user_id", storedUser.ID))
+		clearAuthCookies(w)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	token, err := h.Config.JWT.Create(ctx, storedUser.ID, storedUser.Role, sess.ID)
 	if err != nil {
-		logger.Log.Error("HandleLogin: build token failed",
+		logger.Log.Error("HandleTokenRefresh: build token failed",
 			zap.Error(err))
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	cookie := http.Cookie{
+	h.writeTokens(w, r, token, refreshToken)
+}
+
+// startSession создаёт сессию пользователя и возвращает токен доступа и токен обновления
+func (h *UserHandler) startSession(r *http.Request, u *user.User) (*hash.Token, string, error) {
+	ctx := r.Context()
+
+	sess := session.Session{
+		UserID:    u.ID,
+		UserAgent: r.UserAgent(),
+		ExpiresAt: time.Now().Add(h.Config.RefreshExp),
+	}
+	refreshToken, err := h.Sessions.Create(ctx, &sess)
+	if err != nil {
+		return nil, "", fmt.Errorf("startSession: create session failed %w", err)
+	}
+
+	token, err := h.Config.JWT.Create(ctx, u.ID, u.Role, sess.ID)
+	if err != nil {
+		return nil, "", fmt.Errorf("startSession: build token failed %w", err)
+	}
+
+	return token, refreshToken, nil
+}
+
+// writeTokens устанавливает cookie авторизации и, если клиент принимает JSON,
+// передаёт токены в теле ответа; cookie доступа действует для всех маршрутов API,
+// включая маршруты администратора
+func (h *UserHandler) writeTokens(w http.ResponseWriter, r *http.Request, token *hash.Token, refreshToken string) {
+	// Удаление cookie доступа, выданной ранее только для /api/user/, чтобы она не перекрывала новую
+	http.SetCookie(w, &http.Cookie{
+		Name: "auth",
+		Path: "/api/user/",
+		// Secure:   true,
+		HttpOnly: true,
+		MaxAge:   -1,
+	})
+	http.SetCookie(w, &http.Cookie{
 		Name:  "auth",
-		Value: token,
-		Path:  "/api/user/",
+		Value: token.Value,
+		Path:  "/api/",
 		// Secure:   true,
 		HttpOnly: true,
 		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:   "refresh",
+		Value:  refreshToken,
+		Path:   "/api/user/token/",
+		MaxAge: int(h.Config.RefreshExp.Seconds()),
+		// Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	if !strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	resp := responseTokens{
+		AccessToken:  token.Value,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(time.Until(token.ExpiresAt).Seconds()),
 	}
-	http.SetCookie(w, &cookie)
+	respJSON, err := json.Marshal(resp)
+	if err != nil {
+		logger.Log.Error("writeTokens: response marshal failed",
+			zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(respJSON))
 }
 
-// HandleLogout проводит операцию выхода из системы для пользователя
-func (h *UserHandler) HandleLogout(w http.ResponseWriter, r *http.Request) {
+// clearAuthCookies удаляет cookie авторизации
+func clearAuthCookies(w http.ResponseWriter) {
 	http.SetCookie(w, &http.Cookie{
 		Name: "auth",
-		Path: "/api/user/",
+		Path: "/api/",
+		// Secure:   true,
+		HttpOnly: true,
+		MaxAge:   -1,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name: "refresh",
+		Path: "/api/user/token/",
 		// Secure:   true,
 		HttpOnly: true,
 		MaxAge:   -1,
 	})
-
-	w.WriteHeader(http.StatusOK)
 }
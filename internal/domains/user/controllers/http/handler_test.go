@@ -0,0 +1,91 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pavlegich/gophermart/internal/controllers/middlewares"
+	"github.com/pavlegich/gophermart/internal/domains/session"
+	"github.com/pavlegich/gophermart/internal/domains/user"
+	"github.com/pavlegich/gophermart/internal/infra/config"
+	"github.com/pavlegich/gophermart/internal/infra/hash"
+)
+
+// fakeUsers авторизует любого пользователя как администратора
+type fakeUsers struct {
+	user.Service
+}
+
+func (f *fakeUsers) Login(ctx context.Context, u *user.User) (*user.User, error) {
+	return &user.User{ID: 1, Login: u.Login, Role: user.RoleAdmin}, nil
+}
+
+// fakeSessions создаёт сессию с постоянным идентификатором и считает её действующей
+type fakeSessions struct {
+	session.Service
+}
+
+func (f *fakeSessions) Create(ctx context.Context, sess *session.Session) (string, error) {
+	sess.ID = "sid"
+	return "refresh", nil
+}
+
+func (f *fakeSessions) Check(ctx context.Context, id string, userID int) error {
+	return nil
+}
+
+func TestAuthCookieAuthenticatesAdminRoutes(t *testing.T) {
+	key, err := hash.GenerateKey("test")
+	if err != nil {
+		t.Fatalf("generate key failed %v", err)
+	}
+	j, err := hash.NewJWT([]*hash.Key{key}, "", time.Minute)
+	if err != nil {
+		t.Fatalf("create jwt failed %v", err)
+	}
+	cfg := &config.Config{JWT: j, RefreshExp: time.Hour}
+	ss := &fakeSessions{}
+
+	r := chi.NewRouter()
+	protected := r.With(middlewares.WithAuth(j, ss))
+	newHandler(r, protected, cfg, &fakeUsers{}, ss)
+	protected.With(middlewares.RequireRoles(user.RoleAdmin)).Get("/api/admin/users",
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("create cookie jar failed %v", err)
+	}
+	client := &http.Client{Jar: jar}
+
+	resp, err := client.Post(srv.URL+"/api/user/login", "application/json",
+		strings.NewReader(`{"login":"admin","password":"secret"}`))
+	if err != nil {
+		t.Fatalf("login request failed %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected login status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	// Запрос к маршруту администратора авторизуется только cookie, выданной при входе
+	resp, err = client.Get(srv.URL + "/api/admin/users?login=admin")
+	if err != nil {
+		t.Fatalf("admin request failed %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected admin route status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+}
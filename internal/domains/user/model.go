@@ -2,20 +2,33 @@ package user
 
 import (
 	"context"
+	"time"
+)
+
+// Роли пользователей
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
 )
 
 type User struct {
-	ID       int    `json:"id"`
-	Login    string `json:"login"`
-	Password string `json:"password"`
+	ID        int        `json:"id"`
+	Login     string     `json:"login"`
+	Password  string     `json:"password"`
+	Role      string     `json:"-"`
+	BlockedAt *time.Time `json:"-"`
 }
 
 type Service interface {
 	Register(ctx context.Context, user *User) error
 	Login(ctx context.Context, user *User) (*User, error)
+	Get(ctx context.Context, id int) (*User, error)
 }
 
 type Repository interface {
 	GetUserByLogin(ctx context.Context, login string) (*User, error)
+	GetUserByID(ctx context.Context, id int) (*User, error)
 	CreateUser(ctx context.Context, user *User) error
+	SetUserBlocked(ctx context.Context, id int, blocked bool) error
 }
@@ -31,11 +31,11 @@ func (r *Repository) GetUserByLogin(ctx context.Context, login string) (*user.Us
 	}
 
 	// Выполнение запроса на получение строки с данными пользователя
-	row := r.db.QueryRowContext(ctx, `SELECT id, login, password FROM users WHERE login = $1`, login)
+	row := r.db.QueryRowContext(ctx, `SELECT id, login, password, role, blocked_at FROM users WHERE login = $1`, login)
 
 	// Запись данных пользователя в структуру
 	var user user.User
-	err := row.Scan(&user.ID, &user.Login, &user.Password)
+	err := row.Scan(&user.ID, &user.Login, &user.Password, &user.Role, &user.BlockedAt)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, fmt.Errorf("GetUserByLogin: scan row failed %w", errs.ErrUserNotFound)
 	}
@@ -51,6 +51,29 @@ func (r *Repository) GetUserByLogin(ctx context.Context, login string) (*user.Us
 	return &user, nil
 }
 
+// GetUserByID возвращает пользователя по его идентификатору
+func (r *Repository) GetUserByID(ctx context.Context, id int) (*user.User, error) {
+	// Проверка базы данных
+	if err := r.db.PingContext(ctx); err != nil {
+		return nil, fmt.Errorf("GetUserByID: connection to database is died %w", err)
+	}
+
+	// Выполнение запроса на получение строки с данными пользователя
+	row := r.db.QueryRowContext(ctx, `SELECT id, login, password, role, blocked_at FROM users WHERE id = $1`, id)
+
+	// Запись данных пользователя в структуру
+	var user user.User
+	err := row.Scan(&user.ID, &user.Login, &user.Password, &user.Role, &user.BlockedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("GetUserByID: scan row failed %w", errs.ErrUserNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetUserByID: scan row failed %w", err)
+	}
+
+	return &user, nil
+}
+
 // CreateUser сохраняет данные пользователя в хранилище
 func (r *Repository) CreateUser(ctx context.Context, u *user.User) error {
 	// Проверка базы данных
@@ -60,8 +83,8 @@ func (r *Repository) CreateUser(ctx context.Context, u *user.User) error {
 
 	// Выполнение запроса к базе данных
 	var storedID int
-	if err := r.db.QueryRowContext(ctx, `INSERT INTO users (login, password) VALUES ($1, $2) 
-	RETURNING id`, u.Login, u.Password).Scan(&storedID); err != nil {
+	if err := r.db.QueryRowContext(ctx, `INSERT INTO users (login, password, role) VALUES ($1, $2, $3) 
+	RETURNING id`, u.Login, u.Password, u.Role).Scan(&storedID); err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
 			return fmt.Errorf("CreateUser: %w", errs.ErrLoginBusy)
@@ -72,3 +95,28 @@ func (r *Repository) CreateUser(ctx context.Context, u *user.User) error {
 
 	return nil
 }
+
+// SetUserBlocked блокирует или разблокирует учётную запись пользователя
+func (r *Repository) SetUserBlocked(ctx context.Context, id int, blocked bool) error {
+	// Проверка базы данных
+	if err := r.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("SetUserBlocked: connection to database in died %w", err)
+	}
+
+	// Выполнение запроса к базе данных
+	res, err := r.db.ExecContext(ctx, `UPDATE users 
+	SET blocked_at = CASE WHEN $2 THEN COALESCE(blocked_at, NOW()) ELSE NULL END 
+	WHERE id = $1`, id, blocked)
+	if err != nil {
+		return fmt.Errorf("SetUserBlocked: update table failed %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("SetUserBlocked: get affected rows failed %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("SetUserBlocked: %w", errs.ErrUserNotFound)
+	}
+
+	return nil
+}
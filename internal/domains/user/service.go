@@ -26,6 +26,7 @@ func (s *UserService) Register(ctx context.Context, user *User) error {
 		return fmt.Errorf("Register: hash generate failed %w", err)
 	}
 	user.Password = string(hashedPassword)
+	user.Role = RoleUser
 	if err := s.repo.CreateUser(ctx, user); err != nil {
 		return fmt.Errorf("Register: save user failed %w", err)
 	}
@@ -41,5 +42,17 @@ func (s *UserService) Login(ctx context.Context, user *User) (*User, error) {
 	if err := bcrypt.CompareHashAndPassword([]byte(storedUser.Password), []byte(user.Password)); err != nil {
 		return nil, errs.ErrPasswordNotMatch
 	}
+	if storedUser.BlockedAt != nil {
+		return nil, fmt.Errorf("Login: %w", errs.ErrUserBlocked)
+	}
+	return storedUser, nil
+}
+
+// Get возвращает данные пользователя по его идентификатору
+func (s *UserService) Get(ctx context.Context, id int) (*User, error) {
+	storedUser, err := s.repo.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("Get: get user failed %w", err)
+	}
 	return storedUser, nil
 }
@@ -0,0 +1,11 @@
+package errors
+
+import "errors"
+
+var (
+	ErrAccrualNotRegistered = errors.New("order not registered in accrual system")
+	ErrAccrualRateLimited   = errors.New("too many requests to accrual system")
+	ErrAccrualServer        = errors.New("accrual system internal error")
+	ErrAccrualUnexpected    = errors.New("unexpected accrual system response")
+	ErrAccrualUnavailable   = errors.New("accrual system unavailable, circuit breaker is open")
+)
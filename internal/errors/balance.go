@@ -6,4 +6,15 @@ var (
 	ErrInsufficientFunds   = errors.New("account has insufficient funds")
 	ErrOperationsNotFound  = errors.New("balance operations not found")
 	ErrWithdrawalsNotFound = errors.New("withdrawals operations not found")
+	ErrIncorrectAdjustment = errors.New("adjustment must have non-zero amount and reason")
+	ErrIncorrectAmount     = errors.New("amount must be positive")
+	ErrWithdrawalExists    = errors.New("withdrawal for the order already exists")
+	ErrHoldNotFound        = errors.New("hold not found")
+	ErrHoldNotActive       = errors.New("hold is already captured or released")
+	ErrHoldExpired         = errors.New("hold is expired")
+	ErrWithdrawalNotFound  = errors.New("withdrawal not found")
+	ErrWithdrawalReversed  = errors.New("withdrawal is already fully reversed")
+	ErrTransferToSelf      = errors.New("transfer to own account")
+	ErrTransferLimit       = errors.New("transfer limit exceeded")
+	ErrIncorrectFilter     = errors.New("incorrect filter or cursor")
 )
@@ -0,0 +1,8 @@
+package errors
+
+import "errors"
+
+var (
+	ErrIdempotencyKeyMismatch   = errors.New("idempotency key reused with different request")
+	ErrIdempotencyKeyInProgress = errors.New("request with this idempotency key is in progress")
+)
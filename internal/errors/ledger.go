@@ -0,0 +1,7 @@
+package errors
+
+import "errors"
+
+var (
+	ErrPostingUnbalanced = errors.New("ledger posting is not balanced")
+)
@@ -8,4 +8,11 @@ var (
 	ErrIncorrectNumberFormat = errors.New("order has incorrect number format")
 	ErrOrdersNotFound        = errors.New("orders not found for this user")
 	ErrOrderAlreadyProcessed = errors.New("order already processed")
+	ErrOrderNotFound         = errors.New("order not found")
+	ErrIncorrectOrderFilter  = errors.New("incorrect order filter or cursor")
+	ErrIncorrectBatch        = errors.New("batch is empty or too large")
+	ErrNoJobs                = errors.New("no accrual jobs ready")
+	ErrJobStale              = errors.New("accrual job moved to stale")
+	ErrJobLeaseLost          = errors.New("accrual job lease expired and job was claimed again")
+	ErrStaleJobNotFound      = errors.New("stale accrual job not found for order")
 )
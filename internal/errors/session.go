@@ -0,0 +1,12 @@
+package errors
+
+import "errors"
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionRevoked  = errors.New("session revoked")
+	ErrSessionExpired  = errors.New("session expired")
+
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid")
+	ErrRefreshTokenReused  = errors.New("refresh token already used")
+)
@@ -7,4 +7,5 @@ var (
 	ErrUserNotFound     = errors.New("user not found")
 	ErrPasswordNotMatch = errors.New("passwords do not match")
 	ErrUserUnauthorized = errors.New("user unauthorized")
+	ErrUserBlocked      = errors.New("user is blocked")
 )
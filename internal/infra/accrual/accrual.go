@@ -0,0 +1,45 @@
+package accrual
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	errs "github.com/pavlegich/gophermart/internal/errors"
+	"github.com/pavlegich/gophermart/internal/utils"
+)
+
+// Статусы расчёта начисления в системе начисления баллов
+const (
+	StatusRegistered = "REGISTERED"
+	StatusInvalid    = "INVALID"
+	StatusProcessing = "PROCESSING"
+	StatusProcessed  = "PROCESSED"
+)
+
+// Result хранит ответ системы начисления баллов по заказу
+type Result struct {
+	Order   string      `json:"order"`
+	Status  string      `json:"status"`
+	Accrual utils.Money `json:"accrual,omitempty"`
+}
+
+// Client получает информацию о расчёте начисления баллов по заказу
+type Client interface {
+	GetOrder(ctx context.Context, number string) (*Result, error)
+}
+
+// RateLimitError возвращается, когда система начисления баллов ограничила количество запросов,
+// Limit содержит допустимое количество запросов в минуту, если система его сообщила
+type RateLimitError struct {
+	RetryAfter time.Duration
+	Limit      int
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", errs.ErrAccrualRateLimited, e.RetryAfter)
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return errs.ErrAccrualRateLimited
+}
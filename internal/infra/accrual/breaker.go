@@ -0,0 +1,226 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	errs "github.com/pavlegich/gophermart/internal/errors"
+	"github.com/pavlegich/gophermart/internal/infra/logger"
+	"go.uber.org/zap"
+)
+
+// Состояния автоматического выключателя
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// BreakerStats хранит состояние и счётчики автоматического выключателя
+type BreakerStats struct {
+	State    string
+	Failures int
+	Opens    int64
+	Rejected int64
+	OpenedAt time.Time
+}
+
+// Reservation закрепляет пробный запрос полуоткрытого выключателя за обработчиком,
+// нулевое значение означает, что проба не закреплялась
+type Reservation uint64
+
+// reservationKey ключ контекста, в котором обработчик передаёт закреплённую за ним пробу
+type reservationKey struct{}
+
+// WithReservation возвращает контекст, запросы в котором расходуют закреплённую пробу
+func WithReservation(ctx context.Context, r Reservation) context.Context {
+	return context.WithValue(ctx, reservationKey{}, r)
+}
+
+// reservationFromContext возвращает закреплённую пробу из контекста
+func reservationFromContext(ctx context.Context) Reservation {
+	r, _ := ctx.Value(reservationKey{}).(Reservation)
+	return r
+}
+
+// Breaker прекращает запросы к системе начисления баллов после серии сбоев подряд;
+// по истечении таймаута пропускает один пробный запрос и по его результату закрывается или снова открывается
+type Breaker struct {
+	mu        sync.Mutex
+	threshold int
+	timeout   time.Duration
+	state     string
+	failures  int
+	probing   bool
+	reserved  Reservation
+	seq       Reservation
+	opens     int64
+	rejected  int64
+	openedAt  time.Time
+}
+
+// NewBreaker создаёт выключатель, открывающийся после threshold сбоев подряд на время timeout
+func NewBreaker(threshold int, timeout time.Duration) *Breaker {
+	if threshold <= 0 {
+		threshold = 1
+	}
+	return &Breaker{
+		threshold: threshold,
+		timeout:   timeout,
+		state:     BreakerClosed,
+	}
+}
+
+// Reserve проверяет, можно ли сейчас обращаться к системе начисления баллов;
+// по истечении таймаута закрепляет пробный запрос за вызывающим, остальным отказывая до результата пробы.
+// Закреплённую пробу расходует только запрос с контекстом WithReservation, неиспользованная проба снимается Release
+func (b *Breaker) Reserve() (Reservation, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.timeout {
+		b.setState(BreakerHalfOpen)
+	}
+	switch b.state {
+	case BreakerOpen:
+		return 0, false
+	case BreakerHalfOpen:
+		if b.probing || b.reserved != 0 {
+			return 0, false
+		}
+		b.seq++
+		b.reserved = b.seq
+		return b.reserved, true
+	}
+	return 0, true
+}
+
+// Release снимает закреплённую пробу, если запрос по ней так и не был отправлен;
+// проба, уже израсходованная или закреплённую за другим обработчиком, не затрагивается
+func (b *Breaker) Release(r Reservation) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if r != 0 && b.reserved == r {
+		b.reserved = 0
+	}
+}
+
+// Allow разрешает запрос или возвращает ошибку, если выключатель открыт
+// или пробный запрос закреплён за другим обработчиком
+func (b *Breaker) Allow(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.timeout {
+		b.setState(BreakerHalfOpen)
+	}
+	switch b.state {
+	case BreakerOpen:
+		b.rejected++
+		return fmt.Errorf("Allow: %w", errs.ErrAccrualUnavailable)
+	case BreakerHalfOpen:
+		// В полуоткрытом состоянии пропускается только один пробный запрос,
+		// закреплённая проба достаётся только обработчику, за которым она закреплена
+		if b.probing || (b.reserved != 0 && reservationFromContext(ctx) != b.reserved) {
+			b.rejected++
+			return fmt.Errorf("Allow: %w", errs.ErrAccrualUnavailable)
+		}
+		b.reserved = 0
+		b.probing = true
+	}
+	return nil
+}
+
+// Success отмечает успешный запрос и закрывает выключатель
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.probing = false
+	if b.state != BreakerClosed {
+		b.setState(BreakerClosed)
+	}
+}
+
+// Failure отмечает сбой запроса и открывает выключатель при достижении порога или неудачной пробе
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.failures >= b.threshold) {
+		b.openedAt = time.Now()
+		b.opens++
+		b.setState(BreakerOpen)
+	}
+}
+
+// Cancel снимает пробный запрос, не меняя состояние выключателя
+func (b *Breaker) Cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// Stats возвращает текущее состояние и счётчики выключателя
+func (b *Breaker) Stats() BreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return BreakerStats{
+		State:    b.state,
+		Failures: b.failures,
+		Opens:    b.opens,
+		Rejected: b.rejected,
+		OpenedAt: b.openedAt,
+	}
+}
+
+// setState переводит выключатель в новое состояние, вызывается под блокировкой
+func (b *Breaker) setState(state string) {
+	logger.Log.Warn("accrual circuit breaker state changed",
+		zap.String("from", b.state),
+		zap.String("to", state),
+		zap.Int("failures", b.failures))
+	b.state = state
+}
+
+// BreakerClient защищает клиента автоматическим выключателем
+type BreakerClient struct {
+	client  Client
+	breaker *Breaker
+}
+
+func NewBreakerClient(c Client, b *Breaker) *BreakerClient {
+	return &BreakerClient{
+		client:  c,
+		breaker: b,
+	}
+}
+
+// GetOrder запрашивает расчёт начисления баллов по номеру заказа, если выключатель закрыт;
+// сбоем считаются ошибки соединения и внутренние ошибки системы начисления баллов
+func (c *BreakerClient) GetOrder(ctx context.Context, number string) (*Result, error) {
+	if err := c.breaker.Allow(ctx); err != nil {
+		return nil, fmt.Errorf("GetOrder: %w", err)
+	}
+
+	res, err := c.client.GetOrder(ctx, number)
+	switch {
+	case err == nil, errors.Is(err, errs.ErrAccrualNotRegistered), errors.Is(err, errs.ErrAccrualRateLimited),
+		errors.Is(err, errs.ErrAccrualUnexpected):
+		c.breaker.Success()
+	case errors.Is(err, context.Canceled):
+		// Запрос прерван остановкой сервиса, состояние системы начисления неизвестно
+		c.breaker.Cancel()
+	default:
+		c.breaker.Failure()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetOrder: %w", err)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,59 @@
+package accrual
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBreakerReserveProbe(t *testing.T) {
+	ctx := context.Background()
+	b := NewBreaker(1, 10*time.Millisecond)
+	if _, ok := b.Reserve(); !ok {
+		t.Fatalf("expected closed breaker to be ready")
+	}
+	b.Failure()
+	if _, ok := b.Reserve(); ok {
+		t.Fatalf("expected open breaker to reject")
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	// После таймаута пробный запрос закрепляется только за одним обработчиком
+	first, ok := b.Reserve()
+	if !ok {
+		t.Fatalf("expected probe to be reserved")
+	}
+	if _, ok := b.Reserve(); ok {
+		t.Fatalf("expected second reservation to be rejected")
+	}
+
+	// Снятая проба снова доступна, повторное снятие старой пробы не затрагивает новую
+	b.Release(first)
+	r, ok := b.Reserve()
+	if !ok {
+		t.Fatalf("expected probe to be reserved after release")
+	}
+	b.Release(first)
+	if _, ok := b.Reserve(); ok {
+		t.Fatalf("expected stale release to keep the new reservation")
+	}
+
+	// Закреплённую пробу может израсходовать только обработчик, за которым она закреплена
+	if err := b.Allow(ctx); err == nil {
+		t.Fatalf("expected probe reserved by another worker to be rejected")
+	}
+	if err := b.Allow(WithReservation(ctx, r)); err != nil {
+		t.Fatalf("expected reserved probe to be allowed, got %v", err)
+	}
+	if _, ok := b.Reserve(); ok {
+		t.Fatalf("expected reservation to be rejected while probing")
+	}
+	if err := b.Allow(ctx); err == nil {
+		t.Fatalf("expected second probe to be rejected")
+	}
+
+	b.Success()
+	if _, ok := b.Reserve(); !ok || b.Stats().State != BreakerClosed {
+		t.Fatalf("expected breaker to close after successful probe, got %s", b.Stats().State)
+	}
+}
@@ -0,0 +1,137 @@
+package accrual
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	errs "github.com/pavlegich/gophermart/internal/errors"
+	"github.com/pavlegich/gophermart/internal/utils"
+)
+
+// responseOrder хранит ответ системы начисления баллов в исходном виде
+type responseOrder struct {
+	Order   string      `json:"order"`
+	Status  string      `json:"status"`
+	Accrual json.Number `json:"accrual"`
+}
+
+// requestTimeout максимальное время запроса к системе начисления баллов
+const requestTimeout = 10 * time.Second
+
+// HTTPClient обращается к системе начисления баллов по HTTP
+type HTTPClient struct {
+	address string
+	client  *http.Client
+}
+
+func NewClient(address string) *HTTPClient {
+	return &HTTPClient{
+		address: address,
+		client:  &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// GetOrder запрашивает расчёт начисления баллов по номеру заказа
+func (c *HTTPClient) GetOrder(ctx context.Context, number string) (*Result, error) {
+	if c.address == "" {
+		return nil, fmt.Errorf("GetOrder: accrual address is empty")
+	}
+
+	reqURL := c.address + "/api/orders/" + url.PathEscape(number)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("GetOrder: new request forming failed %w", err)
+	}
+
+	// Повторные попытки выполняются через очередь задач, сбои учитывает автоматический выключатель
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("GetOrder: request to accrual system failed %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Обработка полученного статуса системы начисления баллов
+	switch {
+	case resp.StatusCode == http.StatusOK:
+	case resp.StatusCode == http.StatusNoContent:
+		return nil, fmt.Errorf("GetOrder: %w", errs.ErrAccrualNotRegistered)
+	case resp.StatusCode == http.StatusTooManyRequests:
+		var buf bytes.Buffer
+		buf.ReadFrom(resp.Body)
+		return nil, fmt.Errorf("GetOrder: %w", &RateLimitError{
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+			Limit:      parseRateLimit(buf.String()),
+		})
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return nil, fmt.Errorf("GetOrder: status %d %w", resp.StatusCode, errs.ErrAccrualServer)
+	default:
+		return nil, fmt.Errorf("GetOrder: status %d %w", resp.StatusCode, errs.ErrAccrualUnexpected)
+	}
+
+	// Обработка тела ответа системы начисления баллов
+	var buf bytes.Buffer
+	var respJSON responseOrder
+	if _, err := buf.ReadFrom(resp.Body); err != nil {
+		return nil, fmt.Errorf("GetOrder: read response body failed %w", err)
+	}
+	if err := json.Unmarshal(buf.Bytes(), &respJSON); err != nil {
+		return nil, fmt.Errorf("GetOrder: response unmarshal failed %s %w", err, errs.ErrAccrualUnexpected)
+	}
+
+	// Начисление может содержать больше двух знаков после точки, сумма округляется до сотых
+	res := Result{
+		Order:  respJSON.Order,
+		Status: respJSON.Status,
+	}
+	if respJSON.Accrual != "" {
+		accrual, err := utils.ParseMoneyRounded(respJSON.Accrual.String())
+		if err != nil {
+			return nil, fmt.Errorf("GetOrder: parse accrual failed %s %w", err, errs.ErrAccrualUnexpected)
+		}
+		res.Accrual = accrual
+	}
+
+	switch res.Status {
+	case StatusRegistered, StatusInvalid, StatusProcessing, StatusProcessed:
+	default:
+		return nil, fmt.Errorf("GetOrder: invalid response order status %s %w", res.Status, errs.ErrAccrualUnexpected)
+	}
+
+	return &res, nil
+}
+
+// rateLimitPattern соответствует сообщению системы начисления баллов об ограничении запросов
+var rateLimitPattern = regexp.MustCompile(`No more than (\d+) requests per minute allowed`)
+
+// parseRateLimit извлекает допустимое количество запросов в минуту из тела ответа
+func parseRateLimit(body string) int {
+	match := rateLimitPattern.FindStringSubmatch(body)
+	if match == nil {
+		return 0
+	}
+	limit, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0
+	}
+	return limit
+}
+
+// parseRetryAfter разбирает заголовок Retry-After в секундах или в виде даты
+func parseRetryAfter(v string) time.Duration {
+	if seconds, err := strconv.Atoi(v); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
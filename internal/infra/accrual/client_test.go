@@ -0,0 +1,26 @@
+package accrual
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pavlegich/gophermart/internal/utils"
+)
+
+func TestGetOrderRoundsAccrual(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"order":"12345678903","status":"PROCESSED","accrual":500.125}`))
+	}))
+	defer srv.Close()
+
+	res, err := NewClient(srv.URL).GetOrder(context.Background(), "12345678903")
+	if err != nil {
+		t.Fatalf("GetOrder failed %v", err)
+	}
+	if res.Status != StatusProcessed || res.Accrual != utils.Money(50012) {
+		t.Errorf("GetOrder = %+v, want PROCESSED with 500.12", res)
+	}
+}
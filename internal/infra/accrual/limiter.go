@@ -0,0 +1,117 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// defaultPause пауза, если система начисления баллов ограничила запросы без указания времени
+const defaultPause = time.Second
+
+// Limiter распределяет запросы к системе начисления баллов между всеми обработчиками:
+// запросы следуют не чаще установленной частоты и приостанавливаются на время Retry-After
+type Limiter struct {
+	mu          sync.Mutex
+	interval    time.Duration
+	next        time.Time
+	pausedUntil time.Time
+}
+
+// NewLimiter создаёт ограничитель с частотой rpm запросов в минуту, ноль снимает ограничение частоты
+func NewLimiter(rpm int) *Limiter {
+	l := &Limiter{}
+	l.SetRate(rpm)
+	return l
+}
+
+// SetRate устанавливает допустимую частоту запросов в минуту
+func (l *Limiter) SetRate(rpm int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if rpm <= 0 {
+		l.interval = 0
+		return
+	}
+	l.interval = time.Minute / time.Duration(rpm)
+}
+
+// Pause приостанавливает все запросы на указанное время
+func (l *Limiter) Pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// Wait ожидает очереди на запрос с учётом частоты и паузы
+func (l *Limiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	start := time.Now()
+	if l.next.After(start) {
+		start = l.next
+	}
+	if l.pausedUntil.After(start) {
+		start = l.pausedUntil
+	}
+	l.next = start.Add(l.interval)
+	l.mu.Unlock()
+
+	delay := time.Until(start)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("Wait: %w", ctx.Err())
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Throttle подстраивает ограничитель под ответ системы начисления баллов об ограничении запросов
+func (l *Limiter) Throttle(e *RateLimitError) {
+	if e.Limit > 0 {
+		l.SetRate(e.Limit)
+	}
+	pause := e.RetryAfter
+	if pause <= 0 {
+		pause = defaultPause
+	}
+	l.Pause(pause)
+}
+
+// LimitedClient подстраивает общий для всех обработчиков ограничитель под ответы системы начисления баллов
+// об ограничении запросов; очередь на запрос (Wait) обработчик выдерживает до захвата задачи,
+// чтобы ожидание не расходовало аренду задачи
+type LimitedClient struct {
+	client  Client
+	limiter *Limiter
+}
+
+func NewLimitedClient(c Client, l *Limiter) *LimitedClient {
+	return &LimitedClient{
+		client:  c,
+		limiter: l,
+	}
+}
+
+// GetOrder запрашивает расчёт начисления баллов по номеру заказа и при ограничении запросов
+// приостанавливает общую очередь
+func (c *LimitedClient) GetOrder(ctx context.Context, number string) (*Result, error) {
+	res, err := c.client.GetOrder(ctx, number)
+	if err != nil {
+		var rateErr *RateLimitError
+		if errors.As(err, &rateErr) {
+			c.limiter.Throttle(rateErr)
+		}
+		return nil, fmt.Errorf("GetOrder: %w", err)
+	}
+
+	return res, nil
+}
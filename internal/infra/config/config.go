@@ -2,24 +2,42 @@ package config
 
 import (
 	"context"
-	"crypto/rand"
-	"crypto/rsa"
 	"flag"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/caarlos0/env/v6"
 	"github.com/pavlegich/gophermart/internal/infra/hash"
+	"github.com/pavlegich/gophermart/internal/infra/logger"
 )
 
 // Config хранит значения флагов, ключей или переменных окружения
 type Config struct {
-	Address   string `env:"RUN_ADDRESS"`
-	Database  string `env:"DATABASE_URI"`
-	Accrual   string `env:"ACCRUAL_SYSTEM_ADDRESS"`
-	Update    time.Duration
-	RateLimit int
-	JWT       *hash.JWT
+	Address          string        `env:"RUN_ADDRESS"`
+	Database         string        `env:"DATABASE_URI"`
+	Accrual          string        `env:"ACCRUAL_SYSTEM_ADDRESS"`
+	JWTKeys          string        `env:"JWT_KEYS"`
+	JWTActiveKey     string        `env:"JWT_ACTIVE_KEY"`
+	JWTRetiredKeys   string        `env:"JWT_RETIRED_KEYS"`
+	AccessExp        time.Duration `env:"ACCESS_TOKEN_EXP"`
+	RefreshExp       time.Duration `env:"REFRESH_TOKEN_EXP"`
+	IdempotencyTTL   time.Duration `env:"IDEMPOTENCY_TTL"`
+	IdempotencyLease time.Duration `env:"IDEMPOTENCY_LEASE"`
+	HoldExp          time.Duration `env:"HOLD_EXP"`
+	PointsExpiry     int           `env:"POINTS_EXPIRY_MONTHS"`
+	TransferLimit    int           `env:"TRANSFER_LIMIT"`
+	TransferDaily    int           `env:"TRANSFER_DAILY_LIMIT"`
+	AccrualRPM       int           `env:"ACCRUAL_REQUESTS_PER_MINUTE"`
+	JobLease         time.Duration `env:"ACCRUAL_JOB_LEASE"`
+	BreakerLimit     int           `env:"ACCRUAL_BREAKER_FAILURES"`
+	BreakerTimeout   time.Duration `env:"ACCRUAL_BREAKER_TIMEOUT"`
+	JobBackoffMax    time.Duration `env:"ACCRUAL_BACKOFF_MAX"`
+	JobMaxAttempts   int           `env:"ACCRUAL_MAX_ATTEMPTS"`
+	JobMaxAge        time.Duration `env:"ACCRUAL_MAX_AGE"`
+	Update           time.Duration
+	RateLimit        int
+	JWT              *hash.JWT
 }
 
 // ParseFlags обрабатывает значения флагов и переменных окружения
@@ -29,17 +47,26 @@ func ParseFlags(ctx context.Context) (*Config, error) {
 	flag.StringVar(&cfg.Address, "a", "localhost:8080", "Gophermart service running host:port")
 	flag.StringVar(&cfg.Database, "d", "postgresql://localhost:5432/gophermart", "URI (DSN) to database")
 	flag.StringVar(&cfg.Accrual, "r", "http://localhost:8088", "Accrual service host:port")
+	flag.StringVar(&cfg.JWTKeys, "k", "", "Directory or comma-separated PEM files with JWT signing keys")
+	flag.StringVar(&cfg.JWTActiveKey, "kid", "", "ID of the key used to sign new JWT")
+	flag.StringVar(&cfg.JWTRetiredKeys, "kr", "", "Comma-separated IDs of retired JWT keys")
 
 	cfg.Update = 5 * time.Second
 	cfg.RateLimit = 1
-
-	// Создание ключей для JWT
-	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
-	if err != nil {
-		return cfg, fmt.Errorf("ParseFlags: generate private key failed")
-	}
-	tokenExp := 3 * time.Hour
-	cfg.JWT = hash.NewJWT(privateKey, &privateKey.PublicKey, tokenExp)
+	cfg.AccessExp = 15 * time.Minute
+	cfg.RefreshExp = 30 * 24 * time.Hour
+	cfg.IdempotencyTTL = 24 * time.Hour
+	cfg.IdempotencyLease = time.Minute
+	cfg.HoldExp = 15 * time.Minute
+	cfg.PointsExpiry = 12
+	cfg.TransferLimit = 1000
+	cfg.TransferDaily = 5000
+	cfg.JobLease = time.Minute
+	cfg.BreakerLimit = 5
+	cfg.BreakerTimeout = 30 * time.Second
+	cfg.JobBackoffMax = time.Hour
+	cfg.JobMaxAttempts = 50
+	cfg.JobMaxAge = 72 * time.Hour
 
 	flag.Parse()
 
@@ -47,5 +74,42 @@ func ParseFlags(ctx context.Context) (*Config, error) {
 		return cfg, fmt.Errorf("ParseFlags: wrong environment values %w", err)
 	}
 
+	// Загрузка ключей для JWT
+	keys, err := loadJWTKeys(cfg)
+	if err != nil {
+		return cfg, fmt.Errorf("ParseFlags: load jwt keys failed %w", err)
+	}
+	cfg.JWT, err = hash.NewJWT(keys, cfg.JWTActiveKey, cfg.AccessExp)
+	if err != nil {
+		return cfg, fmt.Errorf("ParseFlags: create jwt failed %w", err)
+	}
+
 	return cfg, nil
 }
+
+// loadJWTKeys загружает ключи для JWT, при отсутствии настроек создаёт временный ключ
+func loadJWTKeys(cfg *Config) ([]*hash.Key, error) {
+	if cfg.JWTKeys == "" {
+		logger.Log.Warn("jwt keys are not configured, tokens will not survive restart")
+		key, err := hash.GenerateKey("ephemeral")
+		if err != nil {
+			return nil, fmt.Errorf("loadJWTKeys: %w", err)
+		}
+		return []*hash.Key{key}, nil
+	}
+
+	keys, err := hash.LoadKeys(cfg.JWTKeys)
+	if err != nil {
+		return nil, fmt.Errorf("loadJWTKeys: %w", err)
+	}
+
+	retired := make(map[string]bool)
+	for _, id := range strings.Split(cfg.JWTRetiredKeys, ",") {
+		retired[strings.TrimSpace(id)] = true
+	}
+	for _, k := range keys {
+		k.Retired = retired[k.ID]
+	}
+
+	return keys, nil
+}
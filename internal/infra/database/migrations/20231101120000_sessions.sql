@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id text PRIMARY KEY,
+    user_id integer REFERENCES users (id),
+    user_agent text NOT NULL DEFAULT '',
+    created_at timestamptz DEFAULT NOW(),
+    expires_at timestamptz NOT NULL,
+    revoked_at timestamptz
+);
+
+-- создание индексов
+CREATE INDEX IF NOT EXISTS session_user_id_idx ON sessions (user_id);
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- +goose StatementEnd
+
+DROP INDEX session_user_id_idx;
+DROP TABLE sessions;
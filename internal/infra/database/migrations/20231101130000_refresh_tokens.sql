@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id serial PRIMARY KEY,
+    session_id text REFERENCES sessions (id),
+    token_hash text UNIQUE NOT NULL,
+    created_at timestamptz DEFAULT NOW(),
+    expires_at timestamptz NOT NULL,
+    used_at timestamptz
+);
+
+-- создание индексов
+CREATE INDEX IF NOT EXISTS refresh_token_session_id_idx ON refresh_tokens (session_id);
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- +goose StatementEnd
+
+DROP INDEX refresh_token_session_id_idx;
+DROP TABLE refresh_tokens;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+
+CREATE TYPE role AS ENUM ('user', 'support', 'admin');
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role role NOT NULL DEFAULT 'user';
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- +goose StatementEnd
+
+ALTER TABLE users DROP COLUMN role;
+DROP TYPE role;
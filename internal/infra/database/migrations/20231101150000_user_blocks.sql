@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS blocked_at timestamptz;
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- +goose StatementEnd
+
+ALTER TABLE users DROP COLUMN blocked_at;
@@ -0,0 +1,17 @@
+-- +goose NO TRANSACTION
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+
+ALTER TYPE action ADD VALUE IF NOT EXISTS 'ADJUSTMENT';
+ALTER TABLE balances ADD COLUMN IF NOT EXISTS operator_id integer REFERENCES users (id);
+ALTER TABLE balances ADD COLUMN IF NOT EXISTS reason text;
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- +goose StatementEnd
+
+ALTER TABLE balances DROP COLUMN reason;
+ALTER TABLE balances DROP COLUMN operator_id;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+
+-- суммы хранятся с точностью до сотых, ранее записанные значения округляются
+ALTER TABLE orders ALTER COLUMN accrual TYPE numeric(14, 2);
+ALTER TABLE balances ALTER COLUMN amount TYPE numeric(14, 2);
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- +goose StatementEnd
+
+ALTER TABLE balances ALTER COLUMN amount TYPE decimal;
+ALTER TABLE orders ALTER COLUMN accrual TYPE decimal;
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+
+CREATE TABLE IF NOT EXISTS accounts (
+    user_id integer PRIMARY KEY REFERENCES users (id),
+    current numeric(14, 2) NOT NULL DEFAULT 0,
+    withdrawn numeric(14, 2) NOT NULL DEFAULT 0,
+    updated_at timestamptz DEFAULT NOW()
+);
+
+-- заполнение счетов по истории операций
+INSERT INTO accounts (user_id, current, withdrawn)
+SELECT user_id,
+    COALESCE(SUM(CASE WHEN action = 'WITHDRAWAL' THEN -amount ELSE amount END), 0),
+    COALESCE(SUM(CASE WHEN action = 'WITHDRAWAL' THEN amount ELSE 0 END), 0)
+FROM balances WHERE user_id IS NOT NULL GROUP BY user_id
+ON CONFLICT (user_id) DO NOTHING;
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- +goose StatementEnd
+
+DROP TABLE accounts;
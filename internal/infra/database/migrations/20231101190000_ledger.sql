@@ -0,0 +1,71 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+
+CREATE TABLE IF NOT EXISTS ledger_accounts (
+    id serial PRIMARY KEY,
+    code text UNIQUE NOT NULL,
+    user_id integer REFERENCES users (id),
+    balance numeric(14, 2) NOT NULL DEFAULT 0,
+    created_at timestamptz DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS ledger_postings (
+    id serial PRIMARY KEY,
+    kind text NOT NULL,
+    reference text,
+    balance_id integer REFERENCES balances (id),
+    created_at timestamptz DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS ledger_entries (
+    id serial PRIMARY KEY,
+    posting_id integer NOT NULL REFERENCES ledger_postings (id),
+    account_id integer NOT NULL REFERENCES ledger_accounts (id),
+    amount numeric(14, 2) NOT NULL
+);
+
+-- создание индексов
+CREATE INDEX IF NOT EXISTS ledger_posting_balance_id_idx ON ledger_postings (balance_id);
+CREATE INDEX IF NOT EXISTS ledger_entry_posting_id_idx ON ledger_entries (posting_id);
+CREATE INDEX IF NOT EXISTS ledger_entry_account_id_idx ON ledger_entries (account_id);
+
+-- перенос истории операций в книгу
+INSERT INTO ledger_accounts (code) VALUES ('system:issued'), ('system:redeemed')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO ledger_accounts (code, user_id)
+SELECT DISTINCT 'user:' || user_id, user_id FROM balances WHERE user_id IS NOT NULL
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO ledger_postings (kind, reference, balance_id, created_at)
+SELECT action::text, order_number, id, created_at FROM balances WHERE user_id IS NOT NULL ORDER BY id;
+
+INSERT INTO ledger_entries (posting_id, account_id, amount)
+SELECT p.id, a.id, CASE WHEN b.action = 'WITHDRAWAL' THEN -b.amount ELSE b.amount END
+FROM ledger_postings p
+JOIN balances b ON b.id = p.balance_id
+JOIN ledger_accounts a ON a.user_id = b.user_id;
+
+INSERT INTO ledger_entries (posting_id, account_id, amount)
+SELECT p.id, a.id, CASE WHEN b.action = 'WITHDRAWAL' THEN b.amount ELSE -b.amount END
+FROM ledger_postings p
+JOIN balances b ON b.id = p.balance_id
+JOIN ledger_accounts a ON a.code = CASE WHEN b.action = 'WITHDRAWAL' THEN 'system:redeemed' ELSE 'system:issued' END;
+
+UPDATE ledger_accounts a SET balance = e.total
+FROM (SELECT account_id, SUM(amount) AS total FROM ledger_entries GROUP BY account_id) e
+WHERE e.account_id = a.id;
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- +goose StatementEnd
+
+DROP INDEX ledger_entry_account_id_idx;
+DROP INDEX ledger_entry_posting_id_idx;
+DROP INDEX ledger_posting_balance_id_idx;
+DROP TABLE ledger_entries;
+DROP TABLE ledger_postings;
+DROP TABLE ledger_accounts;
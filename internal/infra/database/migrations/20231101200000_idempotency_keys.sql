@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    user_id integer REFERENCES users (id),
+    key text NOT NULL,
+    fingerprint text NOT NULL,
+    status integer,
+    content_type text,
+    body bytea,
+    created_at timestamptz DEFAULT NOW(),
+    PRIMARY KEY (user_id, key)
+);
+
+-- уникальность списания по заказу создаётся в 20231102070000_withdrawal_order_unique.sql
+-- после разбора накопленных повторных списаний
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- +goose StatementEnd
+
+DROP TABLE idempotency_keys;
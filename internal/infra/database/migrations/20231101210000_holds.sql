@@ -0,0 +1,38 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+
+CREATE TYPE hold_status AS ENUM ('ACTIVE', 'CAPTURED', 'RELEASED', 'EXPIRED');
+CREATE TABLE IF NOT EXISTS holds (
+    id serial PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES users (id),
+    order_number text NOT NULL,
+    amount numeric(14, 2) NOT NULL,
+    status hold_status NOT NULL DEFAULT 'ACTIVE',
+    balance_id integer REFERENCES balances (id),
+    expires_at timestamptz NOT NULL,
+    created_at timestamptz DEFAULT NOW(),
+    updated_at timestamptz DEFAULT NOW()
+);
+
+-- создание индексов
+CREATE INDEX IF NOT EXISTS hold_user_id_idx ON holds (user_id);
+CREATE INDEX IF NOT EXISTS hold_active_expires_idx ON holds (expires_at)
+WHERE status = 'ACTIVE';
+
+-- зарезервированные баллы не входят в текущий баланс
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS held numeric(14, 2) NOT NULL DEFAULT 0;
+ALTER TABLE ledger_postings ADD COLUMN IF NOT EXISTS hold_id integer REFERENCES holds (id);
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- +goose StatementEnd
+
+ALTER TABLE ledger_postings DROP COLUMN hold_id;
+ALTER TABLE accounts DROP COLUMN held;
+DROP INDEX hold_active_expires_idx;
+DROP INDEX hold_user_id_idx;
+DROP TABLE holds;
+DROP TYPE hold_status;
@@ -0,0 +1,19 @@
+-- +goose NO TRANSACTION
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+
+ALTER TYPE action ADD VALUE IF NOT EXISTS 'REVERSAL';
+ALTER TABLE balances ADD COLUMN IF NOT EXISTS reversal_of integer REFERENCES balances (id);
+
+-- списание может быть возвращено только один раз
+CREATE UNIQUE INDEX IF NOT EXISTS balance_reversal_of_idx ON balances (reversal_of);
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- +goose StatementEnd
+
+DROP INDEX balance_reversal_of_idx;
+ALTER TABLE balances DROP COLUMN reversal_of;
@@ -0,0 +1,34 @@
+-- +goose NO TRANSACTION
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+
+ALTER TYPE action ADD VALUE IF NOT EXISTS 'EXPIRATION';
+
+CREATE TABLE IF NOT EXISTS point_lots (
+    id serial PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES users (id),
+    posting_id integer REFERENCES ledger_postings (id),
+    amount numeric(14, 2) NOT NULL,
+    remaining numeric(14, 2) NOT NULL,
+    expires_at timestamptz,
+    created_at timestamptz DEFAULT NOW()
+);
+
+-- создание индексов
+CREATE INDEX IF NOT EXISTS point_lot_user_expires_idx ON point_lots (user_id, expires_at)
+WHERE remaining > 0;
+
+-- накопленные ранее баллы переносятся одной партией со сроком по умолчанию
+INSERT INTO point_lots (user_id, amount, remaining, expires_at)
+SELECT user_id, current + held, current + held, NOW() + interval '12 months'
+FROM accounts WHERE current + held > 0;
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- +goose StatementEnd
+
+DROP INDEX point_lot_user_expires_idx;
+DROP TABLE point_lots;
@@ -0,0 +1,20 @@
+-- +goose NO TRANSACTION
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+
+ALTER TYPE action ADD VALUE IF NOT EXISTS 'TRANSFER_OUT';
+ALTER TYPE action ADD VALUE IF NOT EXISTS 'TRANSFER_IN';
+ALTER TABLE balances ADD COLUMN IF NOT EXISTS counterparty_id integer REFERENCES users (id);
+
+-- создание индексов
+CREATE INDEX IF NOT EXISTS balance_user_action_create_idx ON balances (user_id, action, created_at);
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- +goose StatementEnd
+
+DROP INDEX balance_user_action_create_idx;
+ALTER TABLE balances DROP COLUMN counterparty_id;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+
+-- индекс для постраничной выборки заказов пользователя
+CREATE INDEX IF NOT EXISTS order_user_create_id_idx ON orders (user_id, created_at, id);
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- +goose StatementEnd
+
+DROP INDEX order_user_create_id_idx;
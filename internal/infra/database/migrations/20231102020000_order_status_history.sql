@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+
+CREATE TABLE IF NOT EXISTS order_status_history (
+    id serial PRIMARY KEY,
+    order_id integer NOT NULL REFERENCES orders (id),
+    status status NOT NULL,
+    accrual numeric(14, 2) NOT NULL DEFAULT 0,
+    created_at timestamp DEFAULT NOW()
+);
+
+-- создание индексов
+CREATE INDEX IF NOT EXISTS order_status_history_order_id_idx ON order_status_history (order_id, created_at);
+
+-- заполнение истории по текущему состоянию заказов,
+-- время перехода в текущий статус неизвестно и остаётся пустым
+INSERT INTO order_status_history (order_id, status, created_at)
+SELECT id, 'NEW', created_at FROM orders;
+
+INSERT INTO order_status_history (order_id, status, accrual, created_at)
+SELECT id, status, accrual, NULL FROM orders WHERE status <> 'NEW';
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- +goose StatementEnd
+
+DROP INDEX order_status_history_order_id_idx;
+DROP TABLE order_status_history;
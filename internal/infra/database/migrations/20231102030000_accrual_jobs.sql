@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+
+CREATE TABLE IF NOT EXISTS accrual_jobs (
+    id serial PRIMARY KEY,
+    order_id integer UNIQUE NOT NULL REFERENCES orders (id),
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamp NOT NULL DEFAULT NOW(),
+    locked_until timestamp,
+    created_at timestamp DEFAULT NOW(),
+    updated_at timestamp DEFAULT NOW()
+);
+
+-- создание индексов
+CREATE INDEX IF NOT EXISTS accrual_job_next_attempt_idx ON accrual_jobs (next_attempt_at);
+
+-- постановка в очередь всех необработанных заказов
+INSERT INTO accrual_jobs (order_id)
+SELECT id FROM orders WHERE status NOT IN ('PROCESSED', 'INVALID');
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- +goose StatementEnd
+
+DROP INDEX accrual_job_next_attempt_idx;
+DROP TABLE accrual_jobs;
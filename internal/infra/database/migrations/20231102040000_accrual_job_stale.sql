@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+
+CREATE TYPE accrual_job_status AS ENUM ('PENDING', 'STALE');
+ALTER TABLE accrual_jobs ADD COLUMN status accrual_job_status NOT NULL DEFAULT 'PENDING';
+ALTER TABLE accrual_jobs ADD COLUMN stale_at timestamp;
+
+-- создание индексов
+CREATE INDEX IF NOT EXISTS accrual_job_stale_idx ON accrual_jobs (stale_at) WHERE status = 'STALE';
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- +goose StatementEnd
+
+DROP INDEX accrual_job_stale_idx;
+ALTER TABLE accrual_jobs DROP COLUMN stale_at;
+ALTER TABLE accrual_jobs DROP COLUMN status;
+DROP TYPE accrual_job_status;
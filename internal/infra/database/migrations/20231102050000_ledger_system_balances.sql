@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+
+-- балансы системных счетов больше не хранятся и вычисляются по движениям
+UPDATE ledger_accounts SET balance = 0 WHERE user_id IS NULL;
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- +goose StatementEnd
+
+UPDATE ledger_accounts a SET balance = COALESCE(e.total, 0)
+FROM (SELECT account_id, SUM(amount) AS total FROM ledger_entries GROUP BY account_id) e
+WHERE e.account_id = a.id AND a.user_id IS NULL;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+
+-- списание может быть возвращено несколькими частями в пределах исходной суммы
+DROP INDEX IF EXISTS balance_reversal_of_idx;
+CREATE INDEX IF NOT EXISTS balance_reversal_of_idx ON balances (reversal_of);
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- +goose StatementEnd
+
+DROP INDEX balance_reversal_of_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS balance_reversal_of_idx ON balances (reversal_of);
@@ -0,0 +1,45 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+
+-- аренда ключа идемпотентности, по истечении которой ключ запроса без ответа можно захватить повторно
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS locked_until timestamptz;
+
+-- повторные списания за один заказ, накопленные до появления ограничения, сохраняются для разбора,
+-- а их номер заказа получает суффикс, чтобы не нарушать уникальность; первое списание остаётся без изменений
+CREATE TABLE IF NOT EXISTS duplicate_withdrawals (
+    balance_id integer PRIMARY KEY REFERENCES balances (id),
+    user_id integer REFERENCES users (id),
+    order_number text NOT NULL,
+    amount numeric(14, 2) NOT NULL,
+    created_at timestamp,
+    moved_at timestamptz DEFAULT NOW()
+);
+
+INSERT INTO duplicate_withdrawals (balance_id, user_id, order_number, amount, created_at)
+SELECT id, user_id, order_number, amount, created_at FROM (
+    SELECT id, user_id, order_number, amount, created_at,
+        ROW_NUMBER() OVER (PARTITION BY order_number ORDER BY created_at, id) AS n
+    FROM balances WHERE action = 'WITHDRAWAL' AND order_number IS NOT NULL
+) w WHERE w.n > 1
+ON CONFLICT (balance_id) DO NOTHING;
+
+UPDATE balances b SET order_number = d.order_number || ':duplicate:' || d.balance_id
+FROM duplicate_withdrawals d WHERE b.id = d.balance_id AND b.order_number = d.order_number;
+
+-- повторное списание за один и тот же заказ невозможно;
+-- в базах, где индекс уже создан прежней версией миграции ключей идемпотентности, он сохраняется
+CREATE UNIQUE INDEX IF NOT EXISTS balance_withdrawal_order_idx ON balances (order_number)
+WHERE action = 'WITHDRAWAL';
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- +goose StatementEnd
+
+DROP INDEX balance_withdrawal_order_idx;
+UPDATE balances b SET order_number = d.order_number
+FROM duplicate_withdrawals d WHERE b.id = d.balance_id;
+DROP TABLE duplicate_withdrawals;
+ALTER TABLE idempotency_keys DROP COLUMN locked_until;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+
+-- срок истечения перенесённых ранее баллов назначается приложением по настройке POINTS_EXPIRY_MONTHS,
+-- а не фиксированным сроком переноса
+UPDATE point_lots SET expires_at = NULL WHERE posting_id IS NULL;
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- +goose StatementEnd
+
+UPDATE point_lots SET expires_at = created_at + interval '12 months'
+WHERE posting_id IS NULL AND expires_at IS NULL;
@@ -2,7 +2,10 @@ package hash
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"time"
 
@@ -11,42 +14,91 @@ import (
 
 type Claims struct {
 	jwt.RegisteredClaims
-	ID int
+	ID        int
+	Role      string `json:"role"`
+	SessionID string `json:"sid"`
+}
+
+// Token хранит подписанный токен и его идентификатор (jti)
+type Token struct {
+	Value     string
+	ID        string
+	ExpiresAt time.Time
 }
 
 type JWT struct {
-	privateKey *rsa.PrivateKey
-	publicKey  *rsa.PublicKey
-	tokenExp   time.Duration
+	keys      map[string]*Key
+	activeKey *Key
+	tokenExp  time.Duration
 }
 
-func NewJWT(privateKey *rsa.PrivateKey, publicKey *rsa.PublicKey, tokenExp time.Duration) *JWT {
-	return &JWT{
-		privateKey: privateKey,
-		publicKey:  publicKey,
-		tokenExp:   tokenExp,
+// NewJWT создаёт JWT с набором ключей, подпись производится активным ключом;
+// если идентификатор активного ключа не указан, выбирается последний по имени ключ с приватной частью
+func NewJWT(keys []*Key, activeID string, tokenExp time.Duration) (*JWT, error) {
+	j := &JWT{
+		keys:     make(map[string]*Key, len(keys)),
+		tokenExp: tokenExp,
+	}
+	for _, k := range keys {
+		if k.PublicKey == nil {
+			return nil, fmt.Errorf("NewJWT: key %s has no public key", k.ID)
+		}
+		j.keys[k.ID] = k
+		if activeID == "" && k.PrivateKey != nil && !k.Retired &&
+			(j.activeKey == nil || k.ID > j.activeKey.ID) {
+			j.activeKey = k
+		}
+	}
+	if activeID != "" {
+		j.activeKey = j.keys[activeID]
+	}
+
+	if j.activeKey == nil {
+		return nil, fmt.Errorf("NewJWT: active signing key not found")
 	}
+	if j.activeKey.PrivateKey == nil {
+		return nil, fmt.Errorf("NewJWT: active key %s has no private key", j.activeKey.ID)
+	}
+	if j.activeKey.Retired {
+		return nil, fmt.Errorf("NewJWT: active key %s is retired", j.activeKey.ID)
+	}
+
+	return j, nil
 }
 
-// Create создаёт токен и возвращает его в виде строки
-func (j *JWT) Create(ctx context.Context, id int) (string, error) {
+// Create создаёт токен доступа с уникальным идентификатором (jti) для сессии пользователя
+func (j *JWT) Create(ctx context.Context, id int, role string, sessionID string) (*Token, error) {
+	tokenID, err := RandomToken(16)
+	if err != nil {
+		return nil, fmt.Errorf("Create: %w", err)
+	}
+	expiresAt := time.Now().Add(j.tokenExp)
+
 	token := jwt.NewWithClaims(jwt.SigningMethodRS256, Claims{
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(j.tokenExp)),
+			ID:        tokenID,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
 		},
-		ID: id,
+		ID:        id,
+		Role:      role,
+		SessionID: sessionID,
 	})
+	token.Header["kid"] = j.activeKey.ID
 
-	tokenString, err := token.SignedString(j.privateKey)
+	tokenString, err := token.SignedString(j.activeKey.PrivateKey)
 	if err != nil {
-		return "", fmt.Errorf("Create: sign string with key failed %w", err)
+		return nil, fmt.Errorf("Create: sign string with key failed %w", err)
 	}
 
-	return tokenString, nil
+	return &Token{
+		Value:     tokenString,
+		ID:        tokenID,
+		ExpiresAt: expiresAt,
+	}, nil
 }
 
 // Validate возвращает полученные из токена данные для аутентификации
-func (j *JWT) Validate(tokenString string) (int, error) {
+func (j *JWT) Validate(tokenString string) (*Claims, error) {
 	claims := &Claims{}
 
 	token, err := jwt.ParseWithClaims(tokenString, claims,
@@ -54,14 +106,48 @@ func (j *JWT) Validate(tokenString string) (int, error) {
 			if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
 				return nil, fmt.Errorf("Validate: unexpected signing method: %v", t.Header["alg"])
 			}
-			return j.publicKey, nil
+			return j.publicKey(t)
 		})
 	if err != nil {
-		return -1, fmt.Errorf("Validate: parse token failed %w", err)
+		return nil, fmt.Errorf("Validate: parse token failed %w", err)
 	}
 	if !token.Valid {
-		return -1, fmt.Errorf("Validate: token is not valid")
+		return nil, fmt.Errorf("Validate: token is not valid")
 	}
+	if claims.RegisteredClaims.ID == "" || claims.SessionID == "" {
+		return nil, fmt.Errorf("Validate: token has no id")
+	}
+
+	return claims, nil
+}
+
+// publicKey возвращает действующий публичный ключ по идентификатору из заголовка токена
+func (j *JWT) publicKey(t *jwt.Token) (*rsa.PublicKey, error) {
+	kid, ok := t.Header["kid"].(string)
+	if !ok || kid == "" {
+		return nil, fmt.Errorf("publicKey: token has no key id")
+	}
+	key, ok := j.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("publicKey: unknown key id %s", kid)
+	}
+	if key.Retired {
+		return nil, fmt.Errorf("publicKey: key %s is retired", kid)
+	}
+	return key.PublicKey, nil
+}
+
+// RandomToken создаёт случайную строку из size байт в шестнадцатеричном виде
+func RandomToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("RandomToken: read random bytes failed %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
 
-	return claims.ID, nil
+// Sum возвращает SHA-256 хеш строки в шестнадцатеричном виде
+func Sum(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,129 @@
+package hash
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Key хранит ключ подписи токенов и его идентификатор (kid)
+type Key struct {
+	ID         string
+	PrivateKey *rsa.PrivateKey
+	PublicKey  *rsa.PublicKey
+	Retired    bool
+}
+
+// GenerateKey создаёт новый ключ подписи с указанным идентификатором
+func GenerateKey(id string) (*Key, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("GenerateKey: generate private key failed %w", err)
+	}
+	return &Key{
+		ID:         id,
+		PrivateKey: privateKey,
+		PublicKey:  &privateKey.PublicKey,
+	}, nil
+}
+
+// LoadKeys загружает ключи из директории или из списка PEM-файлов, перечисленных через запятую
+func LoadKeys(path string) ([]*Key, error) {
+	files := make([]string, 0)
+	for _, p := range strings.Split(path, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, fmt.Errorf("LoadKeys: stat path failed %w", err)
+		}
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		dirFiles, err := filepath.Glob(filepath.Join(p, "*.pem"))
+		if err != nil {
+			return nil, fmt.Errorf("LoadKeys: list directory failed %w", err)
+		}
+		files = append(files, dirFiles...)
+	}
+	sort.Strings(files)
+
+	keys := make([]*Key, 0, len(files))
+	ids := make(map[string]struct{}, len(files))
+	for _, f := range files {
+		key, err := loadKey(f)
+		if err != nil {
+			return nil, fmt.Errorf("LoadKeys: %w", err)
+		}
+		if _, ok := ids[key.ID]; ok {
+			return nil, fmt.Errorf("LoadKeys: duplicate key id %s", key.ID)
+		}
+		ids[key.ID] = struct{}{}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("LoadKeys: no keys found in %s", path)
+	}
+
+	return keys, nil
+}
+
+// loadKey читает ключ из PEM-файла, идентификатором ключа служит имя файла без расширения
+func loadKey(file string) (*Key, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("loadKey: read file %s failed %w", file, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("loadKey: no PEM data in %s", file)
+	}
+
+	key := &Key{
+		ID: strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)),
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key.PrivateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		var parsed any
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err == nil {
+			var ok bool
+			if key.PrivateKey, ok = parsed.(*rsa.PrivateKey); !ok {
+				return nil, fmt.Errorf("loadKey: %s is not an RSA private key", file)
+			}
+		}
+	case "RSA PUBLIC KEY":
+		key.PublicKey, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		var parsed any
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+		if err == nil {
+			var ok bool
+			if key.PublicKey, ok = parsed.(*rsa.PublicKey); !ok {
+				return nil, fmt.Errorf("loadKey: %s is not an RSA public key", file)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("loadKey: unsupported PEM block %s in %s", block.Type, file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loadKey: parse %s failed %w", file, err)
+	}
+	if key.PrivateKey != nil {
+		key.PublicKey = &key.PrivateKey.PublicKey
+	}
+
+	return key, nil
+}
@@ -2,22 +2,75 @@ package utils
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 )
 
 type contextKey int
 
-const ContextIDKey contextKey = iota
+const (
+	ContextPrincipalKey contextKey = iota
+	contextTxKey
+)
 
-// GetUserIDFromContext возвращает ID пользователя из контекста
-func GetUserIDFromContext(ctx context.Context) (int, error) {
-	ctxValue := ctx.Value(ContextIDKey)
+// Principal хранит данные аутентифицированного пользователя
+type Principal struct {
+	UserID    int
+	Role      string
+	SessionID string
+}
+
+// HasRole проверяет, что роль пользователя входит в список допустимых
+func (p *Principal) HasRole(roles ...string) bool {
+	for _, role := range roles {
+		if p.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// GetPrincipalFromContext возвращает данные аутентифицированного пользователя из контекста
+func GetPrincipalFromContext(ctx context.Context) (*Principal, error) {
+	ctxValue := ctx.Value(ContextPrincipalKey)
 	if ctxValue == nil {
-		return -1, fmt.Errorf("GetUserIDFromContext: get context value failed")
+		return nil, fmt.Errorf("GetPrincipalFromContext: get context value failed")
 	}
-	userID, ok := ctxValue.(int)
+	principal, ok := ctxValue.(*Principal)
 	if !ok {
-		return -1, fmt.Errorf("GetUserIDFromContext: convert context value into integer failed")
+		return nil, fmt.Errorf("GetPrincipalFromContext: convert context value into principal failed")
+	}
+	return principal, nil
+}
+
+// GetUserIDFromContext возвращает ID пользователя из контекста
+func GetUserIDFromContext(ctx context.Context) (int, error) {
+	principal, err := GetPrincipalFromContext(ctx)
+	if err != nil {
+		return -1, fmt.Errorf("GetUserIDFromContext: %w", err)
+	}
+	return principal.UserID, nil
+}
+
+// GetSessionIDFromContext возвращает идентификатор сессии пользователя из контекста
+func GetSessionIDFromContext(ctx context.Context) (string, error) {
+	principal, err := GetPrincipalFromContext(ctx)
+	if err != nil {
+		return "", fmt.Errorf("GetSessionIDFromContext: %w", err)
+	}
+	return principal.SessionID, nil
+}
+
+// WithTx возвращает контекст с транзакцией операции, в которой выполняют запросы все участники единицы работы
+func WithTx(ctx context.Context, tx *sql.Tx) context.Context {
+	return context.WithValue(ctx, contextTxKey, tx)
+}
+
+// GetTxFromContext возвращает транзакцию операции из контекста
+func GetTxFromContext(ctx context.Context) (*sql.Tx, error) {
+	tx, ok := ctx.Value(contextTxKey).(*sql.Tx)
+	if !ok || tx == nil {
+		return nil, fmt.Errorf("GetTxFromContext: transaction not found in context")
 	}
-	return userID, nil
+	return tx, nil
 }
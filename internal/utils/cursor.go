@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cursor хранит позицию последней записи страницы для постраничной выборки по времени создания и идентификатору
+type Cursor struct {
+	CreatedAt time.Time
+	ID        int
+}
+
+// Encode возвращает курсор в виде непрозрачной строки
+func (c Cursor) Encode() string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + strconv.Itoa(c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor разбирает курсор, полученный от клиента
+func DecodeCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("DecodeCursor: decode string failed %w", err)
+	}
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, fmt.Errorf("DecodeCursor: malformed cursor")
+	}
+
+	var c Cursor
+	c.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return nil, fmt.Errorf("DecodeCursor: parse time failed %w", err)
+	}
+	c.ID, err = strconv.Atoi(id)
+	if err != nil {
+		return nil, fmt.Errorf("DecodeCursor: parse id failed %w", err)
+	}
+	return &c, nil
+}
+
+// ParseTimeParam разбирает время в формате RFC3339 или дату из параметра запроса;
+// для конца периода (end) дата включается целиком
+func ParseTimeParam(v string, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("ParseTimeParam: incorrect time %s", v)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
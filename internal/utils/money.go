@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Money хранит сумму баллов в сотых долях (копейках), чтобы избежать ошибок округления
+type Money int64
+
+// moneyScale количество сотых долей в одном балле
+const moneyScale = 100
+
+// ParseMoney преобразует десятичную строку в сумму, допускается не более двух знаков после точки
+func ParseMoney(s string) (Money, error) {
+	return parseMoney(s, false)
+}
+
+// ParseMoneyRounded преобразует десятичную строку в сумму,
+// лишние знаки после точки округляются до сотых по банковскому правилу (половина к чётному)
+func ParseMoneyRounded(s string) (Money, error) {
+	return parseMoney(s, true)
+}
+
+// NewMoneyFromUnits возвращает сумму из целого количества баллов без потери точности
+func NewMoneyFromUnits(units int64) Money {
+	return Money(units * moneyScale)
+}
+
+// NewMoneyFromFloat преобразует число с плавающей точкой в сумму с округлением до сотых
+func NewMoneyFromFloat(f float64) Money {
+	if f < 0 {
+		return Money(f*moneyScale - 0.5)
+	}
+	return Money(f*moneyScale + 0.5)
+}
+
+// parseMoney разбирает десятичную строку, при round лишние знаки после точки округляются половиной к чётному
+func parseMoney(s string, round bool) (Money, error) {
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+
+	// Экспоненциальная запись приводится к десятичной без потери знаков
+	if strings.ContainsAny(s, "eE") {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("parseMoney: parse float failed %w", err)
+		}
+		s = strconv.FormatFloat(f, 'f', -1, 64)
+	}
+
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	if intPart == "" && fracPart == "" {
+		return 0, fmt.Errorf("parseMoney: empty value")
+	}
+	if intPart == "" {
+		intPart = "0"
+	}
+
+	// Отделение лишних знаков после точки
+	var extra string
+	if len(fracPart) > 2 {
+		extra = strings.TrimRight(fracPart[2:], "0")
+		if extra != "" && !round {
+			return 0, fmt.Errorf("parseMoney: too many fractional digits in %s", s)
+		}
+		if strings.IndexFunc(extra, func(r rune) bool { return r < '0' || r > '9' }) != -1 {
+			return 0, fmt.Errorf("parseMoney: invalid fractional part %s", fracPart)
+		}
+		fracPart = fracPart[:2]
+	}
+	fracPart += strings.Repeat("0", 2-len(fracPart))
+
+	units, err := strconv.ParseUint(intPart, 10, 63)
+	if err != nil {
+		return 0, fmt.Errorf("parseMoney: parse integer part failed %w", err)
+	}
+	cents, err := strconv.ParseUint(fracPart, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("parseMoney: parse fractional part failed %w", err)
+	}
+
+	m := Money(units*moneyScale + cents)
+	// Ровно половина округляется к чётному, больше половины — вверх
+	if extra != "" && (extra[0] > '5' || (extra[0] == '5' && (len(extra) > 1 || m%2 == 1))) {
+		m++
+	}
+	if negative {
+		m = -m
+	}
+	return m, nil
+}
+
+// String возвращает сумму в виде десятичной строки без лишних нулей
+func (m Money) String() string {
+	sign := ""
+	if m < 0 {
+		sign = "-"
+		m = -m
+	}
+	units, cents := int64(m)/moneyScale, int64(m)%moneyScale
+	if cents == 0 {
+		return fmt.Sprintf("%s%d", sign, units)
+	}
+	return strings.TrimRight(fmt.Sprintf("%s%d.%02d", sign, units, cents), "0")
+}
+
+// Float64 возвращает сумму в виде числа с плавающей точкой, только для отображения
+func (m Money) Float64() float64 {
+	return float64(m) / moneyScale
+}
+
+// MarshalJSON кодирует сумму в виде числа JSON
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON декодирует сумму из числа JSON
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	parsed, err := ParseMoney(s)
+	if err != nil {
+		return fmt.Errorf("UnmarshalJSON: %w", err)
+	}
+	*m = parsed
+	return nil
+}
+
+// Scan читает сумму из столбца базы данных
+func (m *Money) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+	case int64:
+		*m = Money(v * moneyScale)
+	case float64:
+		*m = NewMoneyFromFloat(v)
+	case []byte:
+		parsed, err := parseMoney(string(v), true)
+		if err != nil {
+			return fmt.Errorf("Scan: %w", err)
+		}
+		*m = parsed
+	case string:
+		parsed, err := parseMoney(v, true)
+		if err != nil {
+			return fmt.Errorf("Scan: %w", err)
+		}
+		*m = parsed
+	default:
+		return fmt.Errorf("Scan: unsupported type %T", src)
+	}
+	return nil
+}
+
+// Value возвращает сумму для записи в столбец базы данных
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
@@ -0,0 +1,170 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{name: "integer", in: "100", want: 10000},
+		{name: "one fractional digit", in: "12.5", want: 1250},
+		{name: "two fractional digits", in: "12.34", want: 1234},
+		{name: "trailing zeros", in: "12.3400", want: 1234},
+		{name: "no integer part", in: ".5", want: 50},
+		{name: "negative", in: "-7.05", want: -705},
+		{name: "plus sign", in: "+3", want: 300},
+		{name: "spaces", in: " 1.1 ", want: 110},
+		{name: "exponent", in: "1.5e2", want: 15000},
+		{name: "too many digits", in: "1.234", wantErr: true},
+		{name: "too many digits in exponent", in: "1.234e-1", wantErr: true},
+		{name: "empty", in: "", wantErr: true},
+		{name: "letters", in: "abc", wantErr: true},
+		{name: "letters in fraction", in: "1.2a", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMoney(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMoney(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseMoney(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMoneyRounded(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{name: "exact", in: "729.98", want: 72998},
+		{name: "below half", in: "1.234", want: 123},
+		{name: "above half", in: "1.236", want: 124},
+		{name: "half to even down", in: "1.225", want: 122},
+		{name: "half to even up", in: "1.235", want: 124},
+		{name: "half with tail rounds up", in: "1.2251", want: 123},
+		{name: "half with zeros is a tie", in: "1.22500", want: 122},
+		{name: "carry into units", in: "0.995", want: 100},
+		{name: "negative half to even", in: "-1.235", want: -124},
+		{name: "exponent", in: "1.2345e1", want: 1234},
+		{name: "letters in fraction", in: "1.23a", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMoneyRounded(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMoneyRounded(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseMoneyRounded(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		in   Money
+		want string
+	}{
+		{in: 0, want: "0"},
+		{in: 10000, want: "100"},
+		{in: 1250, want: "12.5"},
+		{in: 1234, want: "12.34"},
+		{in: 5, want: "0.05"},
+		{in: -705, want: "-7.05"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.String(); got != tt.want {
+			t.Errorf("Money(%d).String() = %s, want %s", int64(tt.in), got, tt.want)
+		}
+	}
+}
+
+func TestNewMoneyFromFloat(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want Money
+	}{
+		{in: 0, want: 0},
+		{in: 1000, want: 100000},
+		{in: 0.1 + 0.2, want: 30},
+		{in: 12.345, want: 1235},
+		{in: -12.345, want: -1235},
+	}
+	for _, tt := range tests {
+		if got := NewMoneyFromFloat(tt.in); got != tt.want {
+			t.Errorf("NewMoneyFromFloat(%v) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNewMoneyFromUnits(t *testing.T) {
+	for _, units := range []int64{0, 1000, 90071992547409} {
+		if got := NewMoneyFromUnits(units); int64(got) != units*100 {
+			t.Errorf("NewMoneyFromUnits(%d) = %d, want %d", units, got, units*100)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	var v struct {
+		Sum Money `json:"sum"`
+	}
+	if err := json.Unmarshal([]byte(`{"sum": 751.5}`), &v); err != nil {
+		t.Fatalf("unmarshal failed %v", err)
+	}
+	if v.Sum != 75150 {
+		t.Errorf("unmarshal = %d, want 75150", v.Sum)
+	}
+	if err := json.Unmarshal([]byte(`{"sum": 1.001}`), &v); err == nil {
+		t.Errorf("unmarshal of 1.001 expected error")
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal failed %v", err)
+	}
+	if string(data) != `{"sum":751.5}` {
+		t.Errorf("marshal = %s", data)
+	}
+}
+
+func TestMoneyScan(t *testing.T) {
+	tests := []struct {
+		name string
+		src  any
+		want Money
+	}{
+		{name: "nil", src: nil, want: 0},
+		{name: "int64", src: int64(5), want: 500},
+		{name: "float64", src: 1.25, want: 125},
+		{name: "bytes", src: []byte("12.34"), want: 1234},
+		{name: "string with extra digits", src: "12.345", want: 1234},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m Money
+			if err := m.Scan(tt.src); err != nil {
+				t.Fatalf("Scan(%v) failed %v", tt.src, err)
+			}
+			if m != tt.want {
+				t.Errorf("Scan(%v) = %d, want %d", tt.src, m, tt.want)
+			}
+		})
+	}
+	var m Money
+	if err := m.Scan(true); err == nil {
+		t.Errorf("Scan(bool) expected error")
+	}
+}
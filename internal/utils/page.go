@@ -0,0 +1,144 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Page хранит общие условия постраничной выборки по времени создания и идентификатору
+type Page struct {
+	From      *time.Time
+	To        *time.Time
+	Ascending bool
+	Limit     int
+	Cursor    *Cursor
+}
+
+// ParsePage разбирает общие параметры постраничной выборки:
+// limit, cursor, from, to (RFC3339 или дата) и order (asc или desc)
+func ParsePage(q url.Values) (Page, error) {
+	var p Page
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return p, fmt.Errorf("ParsePage: incorrect limit %s", v)
+		}
+		p.Limit = limit
+	}
+	if v := q.Get("cursor"); v != "" {
+		cursor, err := DecodeCursor(v)
+		if err != nil {
+			return p, fmt.Errorf("ParsePage: %w", err)
+		}
+		p.Cursor = cursor
+	}
+	if v := q.Get("from"); v != "" {
+		from, err := ParseTimeParam(v, false)
+		if err != nil {
+			return p, fmt.Errorf("ParsePage: %w", err)
+		}
+		p.From = &from
+	}
+	if v := q.Get("to"); v != "" {
+		to, err := ParseTimeParam(v, true)
+		if err != nil {
+			return p, fmt.Errorf("ParsePage: %w", err)
+		}
+		p.To = &to
+	}
+	switch strings.ToLower(q.Get("order")) {
+	case "", "desc":
+	case "asc":
+		p.Ascending = true
+	default:
+		return p, fmt.Errorf("ParsePage: incorrect order %s", q.Get("order"))
+	}
+
+	return p, nil
+}
+
+// ParseListParam собирает значения параметра запроса, переданные через запятую или повтором, в верхнем регистре
+func ParseListParam(q url.Values, key string) []string {
+	var values []string
+	for _, v := range q[key] {
+		for _, value := range strings.Split(v, ",") {
+			if value = strings.ToUpper(strings.TrimSpace(value)); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+// Normalize проверяет период выборки и ограничивает размер страницы
+func (p *Page) Normalize(defaultLimit int, maxLimit int) bool {
+	if p.From != nil && p.To != nil && !p.From.Before(*p.To) {
+		return false
+	}
+	if p.Limit <= 0 {
+		p.Limit = defaultLimit
+	}
+	if p.Limit > maxLimit {
+		p.Limit = maxLimit
+	}
+	return true
+}
+
+// FetchPage запрашивает на одну запись больше размера страницы, чтобы определить наличие следующей страницы,
+// и возвращает записи страницы с курсором следующей страницы
+func FetchPage[T any](p *Page, fetch func() ([]T, error), cursor func(T) Cursor) ([]T, *Cursor, error) {
+	limit := p.Limit
+	p.Limit++
+	items, err := fetch()
+	p.Limit = limit
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(items) <= limit {
+		return items, nil, nil
+	}
+
+	items = items[:limit]
+	next := cursor(items[limit-1])
+	return items, &next, nil
+}
+
+// PageQuery собирает условия и аргументы SQL-запроса постраничной выборки
+type PageQuery struct {
+	Args  []any
+	conds []string
+}
+
+// Arg добавляет аргумент запроса и возвращает его плейсхолдер
+func (q *PageQuery) Arg(v any) string {
+	q.Args = append(q.Args, v)
+	return "$" + strconv.Itoa(len(q.Args))
+}
+
+// Where добавляет условие запроса
+func (q *PageQuery) Where(cond string) {
+	q.conds = append(q.conds, cond)
+}
+
+// Page добавляет условия периода и курсора и возвращает условие WHERE вместе с сортировкой и ограничением
+func (q *PageQuery) Page(p *Page) string {
+	if p.From != nil {
+		q.Where("created_at >= " + q.Arg(p.From.UTC()))
+	}
+	if p.To != nil {
+		q.Where("created_at < " + q.Arg(p.To.UTC()))
+	}
+	direction, cmp := "DESC", "<"
+	if p.Ascending {
+		direction, cmp = "ASC", ">"
+	}
+	if p.Cursor != nil {
+		q.Where("(created_at, id) " + cmp + " (" + q.Arg(p.Cursor.CreatedAt.UTC()) + ", " + q.Arg(p.Cursor.ID) + ")")
+	}
+	return strings.Join(q.conds, " AND ") +
+		" ORDER BY created_at " + direction + ", id " + direction + " LIMIT " + q.Arg(p.Limit)
+}
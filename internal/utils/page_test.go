@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestFetchPage(t *testing.T) {
+	items := []int{1, 2, 3, 4, 5}
+	tests := []struct {
+		name     string
+		limit    int
+		wantLen  int
+		wantNext bool
+	}{
+		{name: "has_next", limit: 2, wantLen: 2, wantNext: true},
+		{name: "exact", limit: 5, wantLen: 5, wantNext: false},
+		{name: "short", limit: 10, wantLen: 5, wantNext: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Page{Limit: tt.limit}
+			var requested int
+			got, next, err := FetchPage(&p, func() ([]int, error) {
+				requested = p.Limit
+				if p.Limit < len(items) {
+					return items[:p.Limit], nil
+				}
+				return items, nil
+			}, func(v int) Cursor {
+				return Cursor{ID: v}
+			})
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if requested != tt.limit+1 || p.Limit != tt.limit {
+				t.Fatalf("expected limit %d requested and restored, got %d and %d", tt.limit+1, requested, p.Limit)
+			}
+			if len(got) != tt.wantLen || (next != nil) != tt.wantNext {
+				t.Fatalf("unexpected page %v next %v", got, next)
+			}
+			if next != nil && next.ID != got[len(got)-1] {
+				t.Fatalf("expected cursor at %d, got %d", got[len(got)-1], next.ID)
+			}
+		})
+	}
+}
+
+func TestPageNormalize(t *testing.T) {
+	from := time.Date(2023, 11, 2, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, -1)
+	p := Page{From: &from, To: &to}
+	if p.Normalize(10, 100) {
+		t.Fatalf("expected empty period to be rejected")
+	}
+
+	p = Page{Limit: 500}
+	if !p.Normalize(10, 100) || p.Limit != 100 {
+		t.Fatalf("expected limit clamped to 100, got %d", p.Limit)
+	}
+	p = Page{}
+	if !p.Normalize(10, 100) || p.Limit != 10 {
+		t.Fatalf("expected default limit 10, got %d", p.Limit)
+	}
+}
+
+func TestParsePage(t *testing.T) {
+	cursor := Cursor{CreatedAt: time.Date(2023, 11, 1, 12, 0, 0, 0, time.UTC), ID: 7}
+	q := url.Values{
+		"limit":  {"5"},
+		"cursor": {cursor.Encode()},
+		"to":     {"2023-11-01"},
+		"order":  {"ASC"},
+		"status": {"new, processed", "invalid"},
+	}
+	p, err := ParsePage(q)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if p.Limit != 5 || !p.Ascending || p.Cursor == nil || p.Cursor.ID != 7 || p.From != nil ||
+		p.To == nil || !p.To.Equal(time.Date(2023, 11, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected page %+v", p)
+	}
+	if got := ParseListParam(q, "status"); len(got) != 3 || got[0] != "NEW" || got[2] != "INVALID" {
+		t.Fatalf("unexpected statuses %v", got)
+	}
+
+	for _, bad := range []url.Values{{"limit": {"0"}}, {"order": {"up"}}, {"cursor": {"%%"}}} {
+		if _, err := ParsePage(bad); err == nil {
+			t.Fatalf("expected error for %v", bad)
+		}
+	}
+}
+
+func TestPageQuery(t *testing.T) {
+	var q PageQuery
+	q.Where("user_id = " + q.Arg(1))
+	got := q.Page(&Page{Limit: 10, Cursor: &Cursor{ID: 3}})
+	want := "user_id = $1 AND (created_at, id) < ($2, $3) ORDER BY created_at DESC, id DESC LIMIT $4"
+	if got != want || len(q.Args) != 4 {
+		t.Fatalf("unexpected query %q with %d args", got, len(q.Args))
+	}
+}